@@ -0,0 +1,200 @@
+package condition
+
+// ArgsFunc is an expression handler that receives its arguments through Args.
+type ArgsFunc func(e *Evaluator, args *Args) (interface{}, error)
+
+// WithArgs converts an ArgsFunc to an ExpressionFunc.
+func WithArgs(f ArgsFunc) ExpressionFunc {
+	return func(e *Evaluator, n *Node) (interface{}, error) {
+		return f(e, NewArgs(e, n))
+	}
+}
+
+// Args gives handlers access to function arguments. Arguments are either
+// passed in as an array or as a single value. They are evaluated on demand,
+// at most once, and accessors report arity and type errors in a standard
+// form.
+type Args struct {
+	e     *Evaluator
+	nodes []*Node
+
+	values    []interface{}
+	errs      []error
+	evaluated []bool
+}
+
+// NewArgs creates Args for the arguments of function node n.
+func NewArgs(e *Evaluator, n *Node) *Args {
+	nodes := functionArgs(n)
+	return &Args{
+		e:         e,
+		nodes:     nodes,
+		values:    make([]interface{}, len(nodes)),
+		errs:      make([]error, len(nodes)),
+		evaluated: make([]bool, len(nodes)),
+	}
+}
+
+// Len returns the number of arguments.
+func (a *Args) Len() int {
+	return len(a.nodes)
+}
+
+// Has returns true if there is an argument at index i. It is used to check
+// for optional arguments.
+func (a *Args) Has(i int) bool {
+	return i >= 0 && i < len(a.nodes)
+}
+
+// Node returns the unevaluated argument at index i.
+func (a *Args) Node(i int) *Node {
+	return a.nodes[i]
+}
+
+// node returns the unevaluated argument at index i. Missing arguments are an
+// arity error.
+func (a *Args) node(i int) (*Node, error) {
+	if !a.Has(i) {
+		return nil, missingArgument(i)
+	}
+
+	return a.nodes[i], nil
+}
+
+func missingArgument(i int) error {
+	return newError(ErrorKindArity, "missing argument %d", i+1)
+}
+
+// Expect returns an arity error unless there are at least min and at most max
+// arguments. Use Variadic as max if there is no upper bound.
+func (a *Args) Expect(min, max int) error {
+	return expectArgs(len(a.nodes), min, max)
+}
+
+// expectArgs returns an arity error unless n is between min and max.
+func expectArgs(n, min, max int) error {
+	if n < min {
+		return newError(ErrorKindArity, errExpectedNArguments, min, n)
+	}
+
+	if max != Variadic && n > max {
+		return newError(ErrorKindArity, errExpectedNArguments, max, n)
+	}
+
+	return nil
+}
+
+// Value evaluates the argument at index i. Missing arguments are an arity
+// error.
+func (a *Args) Value(i int) (interface{}, error) {
+	if !a.Has(i) {
+		return nil, missingArgument(i)
+	}
+
+	if !a.evaluated[i] {
+		a.values[i], a.errs[i] = a.e.evaluateNode(a.nodes[i])
+		a.evaluated[i] = true
+	}
+
+	return a.values[i], a.errs[i]
+}
+
+// Lazy returns a function that evaluates the argument at index i when called.
+// It is used to pass arguments on without evaluating them.
+func (a *Args) Lazy(i int) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		return a.Value(i)
+	}
+}
+
+// typeError reports an argument of unexpected type.
+func (a *Args) typeError(i int, expected ValueType, got interface{}) error {
+	return newError(ErrorKindType, "argument %d: expected %s, got %s", i+1, expected, typeOf(got))
+}
+
+// Number evaluates the argument at index i as a number.
+func (a *Args) Number(i int) (float64, error) {
+	v, err := a.Value(i)
+	if err != nil {
+		return 0, err
+	}
+
+	number, ok := v.(float64)
+	if !ok {
+		return 0, a.typeError(i, TypeNumber, v)
+	}
+
+	return number, nil
+}
+
+// String evaluates the argument at index i as a string.
+func (a *Args) String(i int) (string, error) {
+	v, err := a.Value(i)
+	if err != nil {
+		return "", err
+	}
+
+	str, ok := v.(string)
+	if !ok {
+		return "", a.typeError(i, TypeString, v)
+	}
+
+	return str, nil
+}
+
+// Bool evaluates the argument at index i as a boolean. Other values are not
+// converted, use Predicate for that.
+func (a *Args) Bool(i int) (bool, error) {
+	v, err := a.Value(i)
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		return false, a.typeError(i, TypeBoolean, v)
+	}
+
+	return b, nil
+}
+
+// Predicate evaluates the argument at index i and converts it to a boolean
+// according to the evaluation options.
+func (a *Args) Predicate(i int) (bool, error) {
+	v, err := a.Value(i)
+	if err != nil {
+		return false, err
+	}
+
+	return a.e.predicate(v)
+}
+
+// Array evaluates the argument at index i as an array.
+func (a *Args) Array(i int) ([]interface{}, error) {
+	v, err := a.Value(i)
+	if err != nil {
+		return nil, err
+	}
+
+	arr, ok := v.([]interface{})
+	if !ok {
+		return nil, a.typeError(i, TypeArray, v)
+	}
+
+	return arr, nil
+}
+
+// Object evaluates the argument at index i as an object.
+func (a *Args) Object(i int) (map[string]interface{}, error) {
+	v, err := a.Value(i)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, a.typeError(i, TypeObject, v)
+	}
+
+	return obj, nil
+}
@@ -0,0 +1,192 @@
+package condition
+
+import (
+	"testing"
+)
+
+func TestArgs(t *testing.T) {
+	calls := 0
+	evaluator := NewDefaultEvaluator()
+	evaluator.AddHandler("count", func(e *Evaluator, n *Node) (interface{}, error) {
+		calls++
+		return 1.0, nil
+	})
+
+	var args *Args
+	evaluator.AddHandler("capture", func(e *Evaluator, n *Node) (interface{}, error) {
+		args = NewArgs(e, n)
+		return nil, nil
+	})
+
+	root, err := Parse(`{"capture": [{"count": []}, "a", true, [1], {"object": []}, null, {"missing": []}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := evaluator.Evaluate(nil, root); err != nil {
+		t.Fatal(err)
+	}
+
+	if args.Len() != 7 || !args.Has(6) || args.Has(7) || args.Has(-1) {
+		t.Fatalf("unexpected number of arguments %d", args.Len())
+	}
+	if calls != 0 {
+		t.Errorf("expected arguments not to be evaluated up front, got %d calls", calls)
+	}
+
+	lazy := args.Lazy(0)
+	if calls != 0 {
+		t.Errorf("expected Lazy not to evaluate the argument, got %d calls", calls)
+	}
+	for i := 0; i < 2; i++ {
+		if v, err := lazy(); err != nil || v != 1.0 {
+			t.Errorf("expected 1 got %v, %v", v, err)
+		}
+		if v, err := args.Number(0); err != nil || v != 1.0 {
+			t.Errorf("expected 1 got %v, %v", v, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected argument to be evaluated once, got %d calls", calls)
+	}
+
+	if v, err := args.String(1); err != nil || v != "a" {
+		t.Errorf("expected a got %v, %v", v, err)
+	}
+	if v, err := args.Bool(2); err != nil || v != true {
+		t.Errorf("expected true got %v, %v", v, err)
+	}
+	if v, err := args.Predicate(3); err != nil || v != true {
+		t.Errorf("expected true got %v, %v", v, err)
+	}
+	if v, err := args.Array(3); err != nil || len(v) != 1 {
+		t.Errorf("expected [1] got %v, %v", v, err)
+	}
+	if v, err := args.Object(4); err != nil || len(v) != 0 {
+		t.Errorf("expected {} got %v, %v", v, err)
+	}
+	if v, err := args.Value(5); err != nil || v != nil {
+		t.Errorf("expected null got %v, %v", v, err)
+	}
+	if args.Node(6).Token.Value != "missing" {
+		t.Errorf("unexpected node %s", getNodeName(args.Node(6)))
+	}
+
+	errorCases := []struct {
+		name string
+		err  error
+		kind ErrorKind
+		msg  string
+	}{
+		{name: "expect too few", err: args.Expect(8, 9), kind: ErrorKindArity, msg: "expected 8 argument(s), got 7"},
+		{name: "expect too many", err: args.Expect(1, 2), kind: ErrorKindArity, msg: "expected 2 argument(s), got 7"},
+		{name: "number", err: second(args.Number(1)), kind: ErrorKindType, msg: "argument 2: expected number, got string"},
+		{name: "string", err: second(args.String(0)), kind: ErrorKindType, msg: "argument 1: expected string, got number"},
+		{name: "bool", err: second(args.Bool(5)), kind: ErrorKindType, msg: "argument 6: expected boolean, got null"},
+		{name: "array", err: second(args.Array(4)), kind: ErrorKindType, msg: "argument 5: expected array, got object"},
+		{name: "object", err: second(args.Object(3)), kind: ErrorKindType, msg: "argument 4: expected object, got array"},
+		{name: "missing argument", err: second(args.Value(7)), kind: ErrorKindArity, msg: "missing argument 8"},
+		{name: "evaluation error", err: second(args.Value(6)), kind: ErrorKindUndefined, msg: `no expression handler bound to "missing"`},
+	}
+
+	for _, test := range errorCases {
+		if test.err == nil {
+			t.Errorf("%s expected an error", test.name)
+		} else if ErrorKindOf(test.err) != test.kind || test.err.Error() != test.msg {
+			t.Errorf("%s expected %s error %q got %s error %q", test.name, test.kind, test.msg, ErrorKindOf(test.err), test.err.Error())
+		}
+	}
+
+	if err := args.Expect(0, Variadic); err != nil {
+		t.Errorf("expected no error got %s", err.Error())
+	}
+}
+
+func second(_ interface{}, err error) error {
+	return err
+}
+
+func TestWithArgs(t *testing.T) {
+	evaluator := NewDefaultEvaluator()
+	evaluator.AddHandler("clamp", WithArgs(func(e *Evaluator, args *Args) (interface{}, error) {
+		if err := args.Expect(3, 3); err != nil {
+			return nil, err
+		}
+
+		bounds := [3]float64{}
+		for i := range bounds {
+			v, err := args.Number(i)
+			if err != nil {
+				return nil, err
+			}
+			bounds[i] = v
+		}
+
+		if bounds[0] < bounds[1] {
+			return bounds[1], nil
+		} else if bounds[0] > bounds[2] {
+			return bounds[2], nil
+		}
+		return bounds[0], nil
+	}))
+
+	testCases := []struct {
+		in  string
+		out interface{}
+		err bool
+	}{
+		{in: `{"clamp": [5, 0, 10]}`, out: 5.0},
+		{in: `{"clamp": [-5, 0, 10]}`, out: 0.0},
+		{in: `{"clamp": [{"context": ["x"]}, 0, 10]}`, out: 10.0},
+		{in: `{"clamp": [5, 0]}`, err: true},
+		{in: `{"clamp": [5, "0", 10]}`, err: true},
+	}
+
+	for _, test := range testCases {
+		root, err := Parse(test.in)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test.in, err.Error())
+			continue
+		}
+
+		res, err := evaluator.Evaluate(map[string]interface{}{"x": 50.0}, root)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q expected an error", test.in)
+			}
+		} else if err != nil {
+			t.Errorf("%q got an error: %s", test.in, err.Error())
+		} else if res != test.out {
+			t.Errorf("%q expected %v got %v", test.in, test.out, res)
+		}
+	}
+}
+
+// TestBuiltinsDoNotPanic evaluates every built-in function with malformed
+// arguments.
+func TestBuiltinsDoNotPanic(t *testing.T) {
+	args := []string{
+		`null`, `[]`, `1`, `"a"`, `[null]`, `[[]]`, `[1, 2, 3, 4, 5]`, `[null, null]`,
+		`[null, null, null]`, `{"var": "x"}`, `[[1], [2]]`, `["a", "b", "c", "d"]`, `[[[]]]`,
+		`[{"object": []}, {"object": []}]`,
+	}
+
+	for _, name := range DefaultRegistry.Names() {
+		for _, arg := range args {
+			in := `{"` + name + `": ` + arg + `}`
+			root, err := Parse(in)
+			if err != nil {
+				t.Errorf("%q got an error: %s", in, err.Error())
+				continue
+			}
+
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						t.Errorf("%q panicked: %v", in, r)
+					}
+				}()
+				NewDefaultEvaluator().Evaluate(map[string]interface{}{}, root)
+			}()
+		}
+	}
+}
@@ -4,7 +4,7 @@ package condition
 
 literal := number | string | null | float ;
 
-list := '[', *(literal | function) ,']' ;
+list := '[', *(literal | function | list) ,']' ;
 function := '{', string, ':', list | literal | function, '}' ;
 
 expression := function | list | literal ;
@@ -14,6 +14,7 @@ expression := function | list | literal ;
 import (
 	"fmt"
 	"io"
+	"sync/atomic"
 )
 
 type NodeType int
@@ -32,6 +33,12 @@ type Node struct {
 	Token    Token
 	Parent   *Node
 	Children []*Node
+
+	// compiled caches a pre-processed form of a constant node. It is stored
+	// by the handler of the expression the node is an argument of on first
+	// use. Parsed trees may be shared between evaluators, so it is accessed
+	// atomically.
+	compiled atomic.Value
 }
 
 func (n *Node) appendChild(child *Node) {
@@ -77,7 +84,33 @@ func Parse(expression string) (*Node, error) {
 		tokens: tokens,
 	}
 
-	return buildAST(p)
+	root, err := buildAST(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return root, nil
+}
+
+// literalValue returns the value of a tree made of literals and arrays only.
+// The second return value is false if the tree contains a function.
+func literalValue(n *Node) (interface{}, bool) {
+	switch n.Type {
+	case NodeTypeLiteral:
+		return n.Token.Value, true
+	case NodeTypeArray:
+		res := make([]interface{}, len(n.Children))
+		for i, child := range n.Children {
+			val, ok := literalValue(child)
+			if !ok {
+				return nil, false
+			}
+			res[i] = val
+		}
+		return res, true
+	}
+
+	return nil, false
 }
 
 type parser struct {
@@ -212,6 +245,9 @@ func consumeArrayEnd(p *parser) (consumeFunc, error) {
 	case NodeTypeFunction:
 		p.lastNode = p.lastNode.Parent
 		return consumeFunctionEnd, nil
+	case NodeTypeArray:
+		p.lastNode = p.lastNode.Parent
+		return consumeArrayValue, nil
 	}
 
 	return nil, fmt.Errorf("unsupported parent node for array: %#v\n", p.lastNode.Parent.Type)
@@ -230,6 +266,8 @@ func consumeArrayValue(p *parser) (consumeFunc, error) {
 		return consumeLiteral, nil
 	case TokenTypeBraceOpen:
 		return consumeFunctionStart, nil
+	case TokenTypeBracketOpen:
+		return consumeArrayStart, nil
 	}
 
 	return nil, fmt.Errorf("unexpected token as array value: %s", valueToken.String())
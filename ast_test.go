@@ -45,3 +45,38 @@ func TestAST(t *testing.T) {
 		}
 	}
 }
+
+func TestASTNestedArrays(t *testing.T) {
+	expected := `FUNCTION<functionA>
+ \_ ARRAY
+    |__ ARRAY
+    |   |__ LITERAL<string::a>
+    |    \_ LITERAL<number::1>
+    |__ ARRAY
+    |    \_ ARRAY
+     \_ FUNCTION<functionB>
+         \_ ARRAY
+             \_ ARRAY
+                 \_ LITERAL<bool::true>
+`
+
+	root, err := Parse(`{"functionA": [["a", 1], [[]], {"functionB": [[true]]}]}`)
+	if err != nil {
+		t.Errorf("%s\n", err.Error())
+	} else {
+		res := Stringify(root)
+		if res != expected {
+			t.Errorf("Expected: \n%s\n\nGot: \n%s\n\n", expected, res)
+		}
+	}
+}
+
+func TestParseIgnoresFunctionNames(t *testing.T) {
+	// Parse doesn't depend on built-in functions, objects without a function
+	// name and malformed built-in calls are left to evaluation.
+	for _, in := range []string{`{}`, `{"geo_in_polygon": [[0, 0], "not a polygon"]}`} {
+		if _, err := Parse(in); err != nil {
+			t.Errorf("%s: unexpected error %s", in, err.Error())
+		}
+	}
+}
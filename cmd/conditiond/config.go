@@ -1,26 +1,215 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"github.com/tadasv/conditiond"
 	"os"
+	"sort"
+	"strings"
 )
 
 type EvaluatorConfig struct {
 	// FunctionWhitelist is a list of allowed functions from
-	// ExpressionRegistry. If this slice is nil or empty, then all functions
-	// from the registry will be allowed.
+	// condition.DefaultRegistry. If this slice is nil or empty, then all
+	// functions from the registry will be allowed.
 	FunctionWhitelist []string `json:"func_whitelist"`
 
-	// FunctionMap is a mapping of expression from ExpressionRegistry to a
-	// function name. Function mapping can be used to remap default function
-	// names to other names.
+	// FunctionMap is a mapping of expression from condition.DefaultRegistry
+	// to a function name. Function mapping can be used to remap default
+	// function names to other names.
 	FunctionMap map[string]string `json:"func_map"`
+
+	// Resolvers is a mapping of top level context keys to context resolvers.
+	// Resolvers are used to fetch values that are missing from the context
+	// passed in with the condition.
+	Resolvers map[string]ResolverConfig `json:"resolvers"`
+
+	// Macros is a mapping of user defined function names to their
+	// definitions. Macro names can be used in FunctionWhitelist and
+	// FunctionMap the same way as functions from condition.DefaultRegistry.
+	Macros map[string]MacroConfig `json:"macros"`
+
+	// Strict turns missing context paths and non-boolean predicates into
+	// evaluation errors. It can be overridden per message.
+	Strict bool `json:"strict"`
+
+	// JWTKeys is a mapping of key names to keys used by the jwt_claims
+	// expression to verify token signatures. Tokens select a key with the kid
+	// header.
+	JWTKeys map[string]JWTKeyConfig `json:"jwt_keys"`
+
+	// HMACKeys is a mapping of key names to secrets used by the hmac_sha256
+	// expression. Conditions reference secrets by name only.
+	HMACKeys map[string]HMACKeyConfig `json:"hmac_keys"`
+
+	// Truthiness is the name of the policy used to convert non-boolean
+	// predicates to booleans, non_null (default) or non_empty.
+	Truthiness string `json:"truthiness"`
+
+	// Limits bound the cost of evaluating conditions.
+	Limits LimitsConfig `json:"limits"`
+
+	// PolicyDir is a directory with named conditions. Every *.json file in
+	// the directory is a policy named after the file without the extension.
+	// Messages can refer to a policy instead of sending a condition.
+	PolicyDir string `json:"policy_dir,omitempty"`
+
+	// ContextAllow is a list of context path prefixes, as JSON Pointers or
+	// dotted paths, that conditions may read. If it is empty, every path
+	// that is not denied may be read.
+	ContextAllow []string `json:"context_allow,omitempty"`
+
+	// ContextDeny is a list of context path prefixes that conditions must
+	// not read. Reads of their parents are denied too.
+	ContextDeny []string `json:"context_deny,omitempty"`
+}
+
+// contextPolicy returns the context policy or nil if context reads are not
+// restricted.
+func (c *EvaluatorConfig) contextPolicy() (*condition.ContextPolicy, error) {
+	if len(c.ContextAllow) == 0 && len(c.ContextDeny) == 0 {
+		return nil, nil
+	}
+
+	policy, err := condition.NewContextPolicy(c.ContextAllow, c.ContextDeny)
+	if err != nil {
+		return nil, fmt.Errorf("invalid context path prefix: %s", err.Error())
+	}
+
+	return policy, nil
+}
+
+// LimitsConfig bounds the cost of evaluating conditions. Zero values mean no
+// limit.
+type LimitsConfig struct {
+	// MaxConditionBytes is the maximum size of a condition sent in a
+	// message.
+	MaxConditionBytes int `json:"max_condition_bytes,omitempty"`
+
+	// MaxDepth is the maximum nesting depth of a condition sent in a
+	// message.
+	MaxDepth int `json:"max_depth,omitempty"`
+
+	// MaxCalls is the maximum number of function calls made by a single
+	// evaluation, including calls made by macros and policies.
+	MaxCalls int `json:"max_calls,omitempty"`
+}
+
+// MacroConfig defines a named, parameterised expression.
+type MacroConfig struct {
+	// Params are names of macro arguments. Arguments are accessed in the
+	// body with the var expression.
+	Params []string `json:"params"`
+
+	// Body is the condition expression evaluated when the macro is called.
+	Body json.RawMessage `json:"body"`
+
+	// Description is shown in the function reference.
+	Description string `json:"description,omitempty"`
+}
+
+// ResolverConfig configures a single context resolver. Exactly one of File or
+// URL must be set.
+type ResolverConfig struct {
+	// File is a path to a JSON or NDJSON file with resolver records.
+	File string `json:"file,omitempty"`
+
+	// URL is an HTTP endpoint used to fetch resolved values.
+	URL string `json:"url,omitempty"`
+
+	// KeyPath is a context path to the value used to look up a record, e.g.
+	// ["user_id"].
+	KeyPath []interface{} `json:"key_path,omitempty"`
+
+	// TimeoutMs is HTTP request timeout in milliseconds. Defaults to 1000.
+	TimeoutMs int `json:"timeout_ms,omitempty"`
+}
+
+// JWTKeyConfig configures a single JWT verification key. HS256 keys must have
+// Secret set, RS256 and ES256 keys must have exactly one of PublicKey or
+// PublicKeyFile set.
+type JWTKeyConfig struct {
+	// Algorithm is one of HS256, RS256 or ES256.
+	Algorithm string `json:"alg"`
+
+	// Secret is the HS256 shared secret.
+	Secret string `json:"secret,omitempty"`
+
+	// PublicKey is a PEM encoded public key or certificate.
+	PublicKey string `json:"public_key,omitempty"`
+
+	// PublicKeyFile is a path to a PEM encoded public key or certificate.
+	PublicKeyFile string `json:"public_key_file,omitempty"`
+}
+
+// material returns the secret or the PEM encoded public key.
+func (c JWTKeyConfig) material() ([]byte, error) {
+	if c.Algorithm == condition.JWTAlgorithmHS256 {
+		if c.Secret == "" || c.PublicKey != "" || c.PublicKeyFile != "" {
+			return nil, fmt.Errorf("%s key must have only secret set", c.Algorithm)
+		}
+		return []byte(c.Secret), nil
+	}
+
+	if c.Secret != "" || (c.PublicKey == "") == (c.PublicKeyFile == "") {
+		return nil, fmt.Errorf("%s key must have either public_key or public_key_file set", c.Algorithm)
+	}
+
+	if c.PublicKeyFile != "" {
+		return os.ReadFile(c.PublicKeyFile)
+	}
+
+	return []byte(c.PublicKey), nil
+}
+
+// HMACKeyConfig configures a single HMAC secret. Exactly one of Secret or
+// SecretFile must be set.
+type HMACKeyConfig struct {
+	// Secret is the shared secret.
+	Secret string `json:"secret,omitempty"`
+
+	// SecretFile is a path to a file containing the shared secret. Trailing
+	// newlines are ignored.
+	SecretFile string `json:"secret_file,omitempty"`
+}
+
+// secret returns the configured secret.
+func (c HMACKeyConfig) secret() ([]byte, error) {
+	if (c.Secret == "") == (c.SecretFile == "") {
+		return nil, fmt.Errorf("must have either secret or secret_file set")
+	}
+
+	if c.SecretFile == "" {
+		return []byte(c.Secret), nil
+	}
+
+	data, err := os.ReadFile(c.SecretFile)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := bytes.TrimRight(data, "\r\n")
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("%s is empty", c.SecretFile)
+	}
+
+	return secret, nil
 }
 
+// defaultProfile is the name of the profile configured in the evaluator
+// section.
+const defaultProfile = "default"
+
 type Config struct {
 	EvaluatorConfig EvaluatorConfig `json:"evaluator"`
+
+	// Profiles is a mapping of profile names to evaluator configurations.
+	// Messages and HTTP routes select a profile by name. The evaluator
+	// section is the profile named default. Profiles don't inherit any
+	// settings from it.
+	Profiles map[string]EvaluatorConfig `json:"profiles,omitempty"`
 }
 
 func (c Config) String() string {
@@ -31,34 +220,173 @@ func (c Config) String() string {
 	return string(data)
 }
 
+// profileConfig returns the configuration of a named profile.
+func (c *Config) profileConfig(name string) (*EvaluatorConfig, bool) {
+	if name == defaultProfile {
+		return &c.EvaluatorConfig, true
+	}
+
+	cfg, ok := c.Profiles[name]
+	return &cfg, ok
+}
+
+// profileNames returns sorted names of all profiles, including the default
+// one.
+func (c *Config) profileNames() []string {
+	names := []string{defaultProfile}
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
 func (c Config) Validate() error {
-	for funcName, registeredFunc := range c.EvaluatorConfig.FunctionMap {
-		if _, ok := condition.ExpressionRegistry[registeredFunc]; !ok {
+	if _, ok := c.Profiles[defaultProfile]; ok {
+		return fmt.Errorf("profile %q conflicts with the evaluator section", defaultProfile)
+	}
+
+	if err := c.EvaluatorConfig.Validate(); err != nil {
+		return err
+	}
+
+	for name, profile := range c.Profiles {
+		if name == "" || strings.Contains(name, "/") {
+			return fmt.Errorf("invalid profile name %q", name)
+		}
+
+		if err := profile.Validate(); err != nil {
+			return fmt.Errorf("profile %q: %s", name, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// isAvailableFunction returns true if name is a function from the registry or
+// a configured macro.
+func (c EvaluatorConfig) isAvailableFunction(name string) bool {
+	if _, ok := condition.DefaultRegistry.Lookup(name); ok {
+		return true
+	}
+	_, ok := c.Macros[name]
+	return ok
+}
+
+func (c EvaluatorConfig) Validate() error {
+	for macroName, macro := range c.Macros {
+		if _, ok := condition.DefaultRegistry.Lookup(macroName); ok {
+			return fmt.Errorf("macro %q conflicts with a registry function", macroName)
+		}
+
+		if _, err := condition.Parse(string(macro.Body)); err != nil {
+			return fmt.Errorf("macro %q has invalid body: %s", macroName, err.Error())
+		}
+	}
+
+	for funcName, registeredFunc := range c.FunctionMap {
+		if !c.isAvailableFunction(registeredFunc) {
 			return fmt.Errorf("function map points to unavailable function: %q -> %q", funcName, registeredFunc)
 		}
 	}
 
-	for _, allowedFunc := range c.EvaluatorConfig.FunctionWhitelist {
-		if _, ok := condition.ExpressionRegistry[allowedFunc]; !ok {
-			return fmt.Errorf("whitelisted function %q is not part of the registry. Remove or fix the whitelist value", allowedFunc)
+	for _, allowedFunc := range c.FunctionWhitelist {
+		if !c.isAvailableFunction(allowedFunc) {
+			return fmt.Errorf("whitelisted function %q is not part of the registry or macros. Remove or fix the whitelist value", allowedFunc)
+		}
+	}
+	if _, err := condition.ParseTruthiness(c.Truthiness); err != nil {
+		return err
+	}
+
+	for key, resolver := range c.Resolvers {
+		if (resolver.File == "") == (resolver.URL == "") {
+			return fmt.Errorf("resolver %q must have either file or url set", key)
+		}
+	}
+
+	for name, keyCfg := range c.JWTKeys {
+		material, err := keyCfg.material()
+		if err != nil {
+			return fmt.Errorf("jwt key %q: %s", name, err.Error())
+		}
+
+		if _, err := condition.NewJWTKey(keyCfg.Algorithm, material); err != nil {
+			return fmt.Errorf("jwt key %q: %s", name, err.Error())
+		}
+	}
+
+	for name, keyCfg := range c.HMACKeys {
+		if _, err := keyCfg.secret(); err != nil {
+			return fmt.Errorf("hmac key %q: %s", name, err.Error())
+		}
+	}
+
+	if c.Limits.MaxConditionBytes < 0 || c.Limits.MaxDepth < 0 || c.Limits.MaxCalls < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+
+	contextPolicy, err := c.contextPolicy()
+	if err != nil {
+		return err
+	}
+
+	var readers []string
+	if contextPolicy != nil {
+		readers = contextReaders(enabledFunctions(&c))
+
+		// Macro parameters are read with var, which is not a literal, so
+		// paths passed to macros are treated as wildcards.
+		for name, macro := range c.Macros {
+			body, err := condition.Parse(string(macro.Body))
+			if err != nil {
+				return err
+			}
+
+			if err := contextPolicy.CheckCondition(body, readers...); err != nil {
+				return fmt.Errorf("macro %q: %s", name, err.Error())
+			}
+		}
+	}
+
+	if c.PolicyDir != "" {
+		policies, err := loadPolicies(c.PolicyDir)
+		if err != nil {
+			return err
+		}
+
+		if contextPolicy != nil {
+			for name, root := range policies {
+				if err := contextPolicy.CheckCondition(root, readers...); err != nil {
+					return fmt.Errorf("policy %q: %s", name, err.Error())
+				}
+			}
 		}
 	}
 	return nil
 }
 
+// defaultFunctionMap maps every registry function and macro to itself.
+func defaultFunctionMap(macros map[string]MacroConfig) map[string]string {
+	funcMap := map[string]string{}
+	for _, key := range condition.DefaultRegistry.Names() {
+		funcMap[key] = key
+	}
+	for key := range macros {
+		funcMap[key] = key
+	}
+
+	return funcMap
+}
+
 func getDefaultConfig() *Config {
-	config := &Config{
+	return &Config{
 		EvaluatorConfig: EvaluatorConfig{
 			FunctionWhitelist: nil,
-			FunctionMap:       map[string]string{},
+			FunctionMap:       defaultFunctionMap(nil),
 		},
 	}
-
-	for key := range condition.ExpressionRegistry {
-		config.EvaluatorConfig.FunctionMap[key] = key
-	}
-
-	return config
 }
 
 func GetConfig(configPath string) (*Config, error) {
@@ -69,16 +397,22 @@ func GetConfig(configPath string) (*Config, error) {
 		return config, nil
 	}
 
-	defaultFuncMap := config.EvaluatorConfig.FunctionMap
 	config.EvaluatorConfig.FunctionMap = map[string]string{}
 	if err := json.Unmarshal(configData, config); err != nil {
 		return nil, err
 	}
 
+	// If function map is empty this means that no mapping was provided in the config.
+	// Let's reset it back to the default one.
 	if len(config.EvaluatorConfig.FunctionMap) == 0 {
-		// If function map is empty this means that no mapping was provided in the config.
-		// Let's reset it back to the original one.
-		config.EvaluatorConfig.FunctionMap = defaultFuncMap
+		config.EvaluatorConfig.FunctionMap = defaultFunctionMap(config.EvaluatorConfig.Macros)
+	}
+
+	for name, profile := range config.Profiles {
+		if len(profile.FunctionMap) == 0 {
+			profile.FunctionMap = defaultFunctionMap(profile.Macros)
+			config.Profiles[name] = profile
+		}
 	}
 
 	return config, nil
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tadasv/conditiond"
+)
+
+// runFmt implements the fmt command, which rewrites condition files in the
+// canonical format. Arguments are files or directories with *.json files. The
+// policy directories of all profiles are used if there are no arguments, the
+// configuration is only loaded in that case.
+func runFmt(loadConfig func() (*Config, error), args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := flags.Bool("w", false, "write result to the file instead of stdout")
+	check := flags.Bool("check", false, "list files that are not formatted and fail if there are any")
+	compact := flags.Bool("compact", false, "write conditions on a single line")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		for _, name := range cfg.profileNames() {
+			profileCfg, _ := cfg.profileConfig(name)
+			if profileCfg.PolicyDir != "" {
+				paths = append(paths, profileCfg.PolicyDir)
+			}
+		}
+	}
+
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		dirFiles, err := policyFiles(path)
+		if err != nil {
+			return err
+		}
+		files = append(files, dirFiles...)
+	}
+
+	unformatted := 0
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		formatted, err := formatCondition(data, *compact)
+		if err != nil {
+			return fmt.Errorf("%s: %s", file, err.Error())
+		}
+
+		switch {
+		case *check:
+			if !bytes.Equal(data, formatted) {
+				fmt.Fprintln(out, file)
+				unformatted++
+			}
+		case *write:
+			if !bytes.Equal(data, formatted) {
+				if err := writeFileKeepMode(file, formatted); err != nil {
+					return err
+				}
+			}
+		default:
+			if _, err := out.Write(formatted); err != nil {
+				return err
+			}
+		}
+	}
+
+	if unformatted > 0 {
+		return fmt.Errorf("%d file(s) are not formatted", unformatted)
+	}
+
+	return nil
+}
+
+// writeFileKeepMode replaces the contents of an existing file. Unlike
+// os.WriteFile it never creates the file, so its permissions are kept.
+func writeFileKeepMode(file string, data []byte) error {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// formatCondition returns a condition in the canonical format, indented with
+// two spaces or compact, followed by a newline.
+func formatCondition(data []byte, compact bool) ([]byte, error) {
+	root, err := condition.Parse(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var formatted string
+	if compact {
+		formatted, err = condition.Format(root)
+	} else {
+		formatted, err = condition.FormatIndent(root, "  ")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(formatted + "\n"), nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormatCondition(t *testing.T) {
+	tests := []struct {
+		in       string
+		compact  bool
+		expected string
+	}{
+		{in: `true`, expected: "true\n"},
+		{in: ` {"not" : {"context": "a"}} `, compact: true, expected: "{\"not\":{\"context\":\"a\"}}\n"},
+		{in: `{"not": {"context": "a"}}`, expected: "{\n  \"not\": {\n    \"context\": \"a\"\n  }\n}\n"},
+	}
+
+	for _, test := range tests {
+		formatted, err := formatCondition([]byte(test.in), test.compact)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(formatted) != test.expected {
+			t.Errorf("%s: expected %q got %q", test.in, test.expected, formatted)
+		}
+	}
+
+	if _, err := formatCondition([]byte(`{"and": [], "or": []}`), false); err == nil {
+		t.Errorf("expected an error for an invalid condition")
+	}
+}
+
+// noConfig fails the test if the configuration is loaded.
+func noConfig(t *testing.T) func() (*Config, error) {
+	return func() (*Config, error) {
+		t.Errorf("configuration must not be loaded")
+		return nil, errors.New("no configuration")
+	}
+}
+
+func TestRunFmt(t *testing.T) {
+	dir := t.TempDir()
+	formatted := "{\n  \"not\": true\n}\n"
+	writeFiles(t, dir, map[string]string{
+		"formatted.json":   formatted,
+		"unformatted.json": `{"not":true}`,
+	})
+	unformatted := filepath.Join(dir, "unformatted.json")
+
+	// Printing files doesn't change them.
+	out := &bytes.Buffer{}
+	if err := runFmt(noConfig(t), []string{unformatted}, out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != formatted {
+		t.Errorf("expected %q got %q", formatted, out.String())
+	}
+
+	// -check lists unformatted files and fails.
+	out.Reset()
+	err := runFmt(noConfig(t), []string{"-check", dir}, out)
+	if err == nil || !strings.Contains(err.Error(), "1 file(s) are not formatted") {
+		t.Errorf("expected check to fail, got %v", err)
+	}
+	if out.String() != unformatted+"\n" {
+		t.Errorf("expected %q to be listed, got %q", unformatted, out.String())
+	}
+
+	// -w rewrites files and keeps their permissions.
+	if err := os.Chmod(unformatted, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := runFmt(noConfig(t), []string{"-w", dir}, out); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(unformatted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != formatted {
+		t.Errorf("expected %q got %q", formatted, data)
+	}
+
+	info, err := os.Stat(unformatted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("expected mode 0640 got %o", info.Mode().Perm())
+	}
+
+	if err := runFmt(noConfig(t), []string{"-check", dir}, out); err != nil {
+		t.Errorf("expected formatted files to pass the check, got %v", err)
+	}
+}
+
+func TestRunFmtPolicyDirs(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"policy.json": `{"not":true}`})
+
+	loadConfig := func() (*Config, error) {
+		return &Config{EvaluatorConfig: EvaluatorConfig{PolicyDir: dir}}, nil
+	}
+
+	out := &bytes.Buffer{}
+	if err := runFmt(loadConfig, []string{"-check"}, out); err == nil {
+		t.Errorf("expected the policy directory to be checked")
+	}
+	if !strings.Contains(out.String(), "policy.json") {
+		t.Errorf("expected policy.json to be listed, got %q", out.String())
+	}
+
+	failing := func() (*Config, error) {
+		return nil, errors.New("broken configuration")
+	}
+	if err := runFmt(failing, nil, out); err == nil || err.Error() != "broken configuration" {
+		t.Errorf("expected configuration error, got %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/tadasv/conditiond"
+)
+
+// FunctionInfo describes a function enabled by the configuration.
+type FunctionInfo struct {
+	// Name is the name used in conditions.
+	Name string `json:"name"`
+
+	// Function is the name of the registry function or macro that Name
+	// refers to. It differs from Name for functions renamed with FunctionMap.
+	Function string `json:"function"`
+
+	// Macro is set if Function is a macro.
+	Macro bool `json:"macro,omitempty"`
+
+	condition.FunctionSpec
+}
+
+// enabledFunctions returns functions available to conditions after applying
+// FunctionMap and FunctionWhitelist, sorted by name.
+func enabledFunctions(cfg *EvaluatorConfig) []FunctionInfo {
+	whitelistMap := map[string]interface{}{}
+
+	for _, wl := range cfg.FunctionWhitelist {
+		whitelistMap[wl] = nil
+	}
+
+	functions := []FunctionInfo{}
+	for newFuncName, registryFuncName := range cfg.FunctionMap {
+		// if nothing is whitelisted, we're allowing all functions; otherwise, only the ones that were whitelisted.
+		if _, ok := whitelistMap[registryFuncName]; !ok && cfg.FunctionWhitelist != nil {
+			continue
+		}
+
+		info := FunctionInfo{
+			Name:     newFuncName,
+			Function: registryFuncName,
+		}
+
+		if macro, ok := cfg.Macros[registryFuncName]; ok {
+			info.Macro = true
+			info.FunctionSpec = macroSpec(macro)
+		} else {
+			// It's ok to do this without checking for keys in the registry.  We're
+			// assuming that the configuration was validated on start up and should
+			// contain valid keys.
+			info.FunctionSpec, _ = condition.DefaultRegistry.Lookup(registryFuncName)
+		}
+
+		functions = append(functions, info)
+	}
+
+	sort.Slice(functions, func(i, j int) bool {
+		return functions[i].Name < functions[j].Name
+	})
+
+	return functions
+}
+
+// macroSpec describes a macro. Macro arguments can be of any type.
+func macroSpec(macro MacroConfig) condition.FunctionSpec {
+	spec := condition.FunctionSpec{
+		MinArgs:     len(macro.Params),
+		MaxArgs:     len(macro.Params),
+		Returns:     condition.TypeAny,
+		Description: macro.Description,
+	}
+
+	for _, param := range macro.Params {
+		spec.Args = append(spec.Args, condition.ArgSpec{Name: param, Type: condition.TypeAny})
+	}
+
+	return spec
+}
+
+func writeFunctionsJSON(w io.Writer, functions []FunctionInfo) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(functions)
+}
+
+func writeFunctionsMarkdown(w io.Writer, functions []FunctionInfo) error {
+	buf := &strings.Builder{}
+	buf.WriteString("# Functions\n")
+
+	for _, f := range functions {
+		fmt.Fprintf(buf, "\n## %s\n\n", f.Name)
+
+		if f.Description != "" {
+			fmt.Fprintf(buf, "%s\n\n", f.Description)
+		}
+
+		if f.Macro {
+			fmt.Fprintf(buf, "Macro `%s`.\n\n", f.Function)
+		} else if f.Name != f.Function {
+			fmt.Fprintf(buf, "Built-in function `%s`.\n\n", f.Function)
+		}
+
+		if len(f.Args) > 0 {
+			buf.WriteString("Arguments:\n\n")
+			for i, arg := range f.Args {
+				var notes []string
+				if f.MaxArgs == condition.Variadic && i == len(f.Args)-1 {
+					notes = append(notes, "repeated")
+				}
+				if i >= f.MinArgs {
+					notes = append(notes, "optional")
+				}
+
+				fmt.Fprintf(buf, "- `%s` %s", arg.Name, arg.Type)
+				if len(notes) > 0 {
+					fmt.Fprintf(buf, ", %s", strings.Join(notes, ", "))
+				}
+				buf.WriteString("\n")
+			}
+			buf.WriteString("\n")
+		}
+
+		fmt.Fprintf(buf, "Returns %s.", f.Returns)
+		if f.Pure {
+			buf.WriteString(" Pure.")
+		}
+		buf.WriteString("\n")
+	}
+
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+// runFunctions implements the functions command, which prints a reference of
+// enabled functions.
+func runFunctions(cfg *Config, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("functions", flag.ContinueOnError)
+	format := flags.String("format", "markdown", "output format, markdown or json")
+	profileName := flags.String("profile", defaultProfile, "name of the profile")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	profileCfg, ok := cfg.profileConfig(*profileName)
+	if !ok {
+		return fmt.Errorf("unknown profile %q", *profileName)
+	}
+
+	functions := enabledFunctions(profileCfg)
+	switch *format {
+	case "markdown":
+		return writeFunctionsMarkdown(out, functions)
+	case "json":
+		return writeFunctionsJSON(out, functions)
+	}
+
+	return fmt.Errorf("unknown format %q", *format)
+}
@@ -7,6 +7,9 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"time"
+	_ "time/tzdata"
 
 	"github.com/tadasv/conditiond"
 )
@@ -18,57 +21,172 @@ var (
 	cliIn          = flag.String("cliIn", "-", "path to input file or - (dash) for stdin")
 	cliOut         = flag.String("cliOut", "-", "path to result file or - (dash) for stdout")
 	listenAddress  = flag.String("listenAddress", ":9000", "address to listen to for incoming http connections")
+	cliProfile     = flag.String("profile", defaultProfile, "profile used for CLI messages that don't select one")
 )
 
 type ConditionMessage struct {
 	Condition json.RawMessage `json:"condition"`
 	Context   json.RawMessage `json:"context"`
+
+	// Policy is the name of a policy from the profile policy directory. It
+	// is evaluated instead of Condition.
+	Policy string `json:"policy,omitempty"`
+
+	// Profile is the name of the profile used to evaluate this message.
+	Profile string `json:"profile,omitempty"`
+
+	// Strict overrides evaluator strict mode for this message if set.
+	Strict *bool `json:"strict,omitempty"`
+
+	// Trace requests evaluation trace to be included in the result.
+	Trace bool `json:"trace,omitempty"`
 }
 
 type EvaluationResult struct {
-	Error  *string     `json:"error"`
-	Result interface{} `json:"result"`
+	Error  *string                `json:"error"`
+	Result interface{}            `json:"result"`
+	Trace  []condition.TraceEntry `json:"trace,omitempty"`
 }
 
-func evaluatorFromConfig(cfg *Config) *condition.Evaluator {
-	whitelistMap := map[string]interface{}{}
+// evaluatorTemplate holds the parts of an evaluator configuration that are
+// loaded once, such as resolver files, keys and macro bodies. Evaluators are
+// not safe for concurrent use, newEvaluator builds one per concurrent
+// evaluation from the template.
+type evaluatorTemplate struct {
+	options   condition.Options
+	functions map[string]condition.FunctionSpec
+	macros    map[string]parsedMacro
+	resolvers map[string]condition.ContextResolver
+	jwtKeys   map[string]*condition.JWTKey
+	hmacKeys  map[string][]byte
+}
+
+type parsedMacro struct {
+	params []string
+	body   *condition.Node
+}
 
-	for _, wl := range cfg.EvaluatorConfig.FunctionWhitelist {
-		whitelistMap[wl] = nil
+func newEvaluatorTemplate(cfg *EvaluatorConfig) (*evaluatorTemplate, error) {
+	t := &evaluatorTemplate{
+		functions: map[string]condition.FunctionSpec{},
+		macros:    map[string]parsedMacro{},
+		resolvers: map[string]condition.ContextResolver{},
+		jwtKeys:   map[string]*condition.JWTKey{},
+		hmacKeys:  map[string][]byte{},
 	}
 
-	handlerMap := map[string]condition.ExpressionFunc{}
-	for newFuncName, registryFuncName := range cfg.EvaluatorConfig.FunctionMap {
-		// if nothing is whitelisted, we're allowing all functions; otherwise, only the ones that were whitelisted.
-		if _, ok := whitelistMap[registryFuncName]; ok || cfg.EvaluatorConfig.FunctionWhitelist == nil {
-			// It's ok to do this without checking for keys in the registry.  We're
-			// assuming that the configuration was validated on start up and should
-			// contain valid keys.
-			handlerMap[newFuncName] = condition.ExpressionRegistry[registryFuncName]
+	for _, f := range enabledFunctions(cfg) {
+		if !f.Macro {
+			t.functions[f.Name] = f.FunctionSpec
+			continue
 		}
+
+		macro := cfg.Macros[f.Function]
+		body, err := condition.Parse(string(macro.Body))
+		if err != nil {
+			return nil, fmt.Errorf("macro %q: %s", f.Name, err.Error())
+		}
+		if err := condition.CheckVariables(body, macro.Params...); err != nil {
+			return nil, fmt.Errorf("macro %q: %s", f.Name, err.Error())
+		}
+		t.macros[f.Name] = parsedMacro{params: macro.Params, body: body}
 	}
 
-	evaluator := condition.NewEvaluator()
-	for key, f := range handlerMap {
-		evaluator.AddHandler(key, f)
+	truthiness, err := condition.ParseTruthiness(cfg.Truthiness)
+	if err != nil {
+		return nil, err
 	}
+	t.options = condition.Options{
+		Strict:     cfg.Strict,
+		Truthiness: truthiness,
+	}
+
+	for key, resolverCfg := range cfg.Resolvers {
+		if resolverCfg.File != "" {
+			resolver, err := condition.NewFileResolver(resolverCfg.File, resolverCfg.KeyPath)
+			if err != nil {
+				return nil, fmt.Errorf("resolver %q: %s", key, err.Error())
+			}
+			t.resolvers[key] = resolver
+		} else {
+			timeout := time.Duration(resolverCfg.TimeoutMs) * time.Millisecond
+			if timeout == 0 {
+				timeout = time.Second
+			}
+			t.resolvers[key] = condition.NewHTTPResolver(resolverCfg.URL, resolverCfg.KeyPath, timeout)
+		}
+	}
+
+	for name, keyCfg := range cfg.JWTKeys {
+		material, err := keyCfg.material()
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %q: %s", name, err.Error())
+		}
 
-	return evaluator
+		key, err := condition.NewJWTKey(keyCfg.Algorithm, material)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %q: %s", name, err.Error())
+		}
+		t.jwtKeys[name] = key
+	}
+
+	for name, keyCfg := range cfg.HMACKeys {
+		secret, err := keyCfg.secret()
+		if err != nil {
+			return nil, fmt.Errorf("hmac key %q: %s", name, err.Error())
+		}
+		t.hmacKeys[name] = secret
+	}
+
+	return t, nil
 }
 
-func parseAndEvaluate(e *condition.Evaluator, msg *ConditionMessage) (interface{}, error) {
-	root, err := condition.Parse(string(msg.Condition))
-	if err != nil {
-		return nil, err
+// newEvaluator builds an evaluator from the template. Resolvers, keys and
+// macro bodies are shared between evaluators, they are not modified during
+// evaluation.
+func (t *evaluatorTemplate) newEvaluator() (*condition.Evaluator, error) {
+	evaluator := condition.NewEvaluator()
+	evaluator.SetOptions(t.options)
+	for key, spec := range t.functions {
+		evaluator.AddFunction(key, spec)
+	}
+
+	for key, macro := range t.macros {
+		if err := evaluator.AddMacro(key, macro.params, macro.body); err != nil {
+			return nil, err
+		}
+	}
+
+	for key, resolver := range t.resolvers {
+		evaluator.AddResolver(key, resolver)
 	}
 
-	result, err := e.Evaluate(msg.Context, root)
-	return result, err
+	for name, key := range t.jwtKeys {
+		evaluator.AddJWTKey(name, key)
+	}
+
+	for name, secret := range t.hmacKeys {
+		evaluator.AddHMACKey(name, secret)
+	}
+
+	return evaluator, nil
 }
 
 func main() {
 	flag.Parse()
 
+	// Files are formatted without loading the configuration, policy files
+	// are formatted before validation, which fails if they are invalid.
+	if flag.Arg(0) == "fmt" {
+		loadConfig := func() (*Config, error) {
+			return GetConfig(*configFilePath)
+		}
+		if err := runFmt(loadConfig, flag.Args()[1:], os.Stdout); err != nil {
+			log.Fatalf("fmt: %s", err.Error())
+		}
+		return
+	}
+
 	config, err := GetConfig(*configFilePath)
 	if err != nil {
 		log.Fatalf("unable to read configuration: %s", err.Error())
@@ -83,7 +201,17 @@ func main() {
 		return
 	}
 
-	evaluator := evaluatorFromConfig(config)
+	if flag.Arg(0) == "functions" {
+		if err := runFunctions(config, flag.Args()[1:], os.Stdout); err != nil {
+			log.Fatalf("unable to list functions: %s", err.Error())
+		}
+		return
+	}
+
+	profiles, err := newProfiles(config)
+	if err != nil {
+		log.Fatalf("unable to create evaluator: %s", err.Error())
+	}
 
 	if *cli {
 		var dec *json.Decoder
@@ -118,65 +246,124 @@ func main() {
 				log.Fatalf("unable to decode message: %s", err.Error())
 			}
 
-			value, err := parseAndEvaluate(evaluator, &msg)
-			resultMsg := EvaluationResult{
-				Result: value,
-			}
-			if err != nil {
-				errMsg := err.Error()
-				resultMsg.Error = &errMsg
-			}
-
+			resultMsg := profiles.evaluate(*cliProfile, &msg)
 			if err := enc.Encode(resultMsg); err != nil {
 				log.Fatalf("unable to encode message: %s", err.Error())
 			}
 		}
 	} else {
-		// Healthcheck endpoint
-		http.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
-			w.WriteHeader(http.StatusOK)
-		})
-
-		// Evaluation endpoint
-		http.HandleFunc("/evaluate", func(w http.ResponseWriter, r *http.Request) {
-			if r.Method != http.MethodPost {
-				w.WriteHeader(http.StatusMethodNotAllowed)
-				return
-			}
-			defer r.Body.Close()
-
-			dec := json.NewDecoder(r.Body)
-			enc := json.NewEncoder(w)
-			results := []EvaluationResult{}
-
-			for dec.More() {
-				msg := ConditionMessage{}
-				if err := dec.Decode(&msg); err != nil {
-					w.WriteHeader(http.StatusBadRequest)
-					return
-				}
-
-				value, err := parseAndEvaluate(evaluator, &msg)
-				resultMsg := EvaluationResult{
-					Result: value,
-				}
-				if err != nil {
-					errMsg := err.Error()
-					resultMsg.Error = &errMsg
-				}
-
-				results = append(results, resultMsg)
-			}
+		log.Printf("starting conditiond server on %s", *listenAddress)
+		http.ListenAndServe(*listenAddress, newServeMux(profiles))
+	}
 
-			for _, result := range results {
-				if err := enc.Encode(result); err != nil {
-					// TODO
-				}
-			}
-		})
+}
 
-		log.Printf("starting conditiond server on %s", *listenAddress)
-		http.ListenAndServe(*listenAddress, nil)
+// newServeMux returns the HTTP handler of the daemon.
+func newServeMux(ps profiles) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	// Healthcheck endpoint
+	mux.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// Function reference endpoint. The profile query parameter selects a
+	// profile other than the default one.
+	mux.HandleFunc("/functions", func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("profile")
+		if name == "" {
+			name = defaultProfile
+		}
+		serveFunctions(ps, name, w, r)
+	})
+
+	// Evaluation endpoint. Messages select a profile with the profile key,
+	// the default profile is used otherwise.
+	mux.HandleFunc("/evaluate", func(w http.ResponseWriter, r *http.Request) {
+		serveEvaluate(ps, "", w, r)
+	})
+
+	// Profile endpoints, /profiles/{name}/functions and
+	// /profiles/{name}/evaluate.
+	mux.HandleFunc("/profiles/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/profiles/"), "/")
+		if len(parts) != 2 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch parts[1] {
+		case "functions":
+			serveFunctions(ps, parts[0], w, r)
+		case "evaluate":
+			serveEvaluate(ps, parts[0], w, r)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	return mux
+}
+
+func serveFunctions(ps profiles, name string, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	p, ok := ps[name]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := writeFunctionsJSON(w, p.functions); err != nil {
+		log.Printf("unable to write functions: %s", err.Error())
+	}
+}
+
+// serveEvaluate evaluates a stream of messages. If route is set, messages are
+// evaluated with the route profile and must not select a different one.
+func serveEvaluate(ps profiles, route string, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	defer r.Body.Close()
+
+	if _, ok := ps[route]; route != "" && !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	fallback := route
+	if fallback == "" {
+		fallback = defaultProfile
+	}
+
+	dec := json.NewDecoder(r.Body)
+	enc := json.NewEncoder(w)
+	results := []EvaluationResult{}
+
+	for dec.More() {
+		msg := ConditionMessage{}
+		if err := dec.Decode(&msg); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if route != "" && msg.Profile != "" && msg.Profile != route {
+			results = append(results, errorResult(fmt.Errorf("message profile %q does not match profile %q", msg.Profile, route)))
+			continue
+		}
+
+		results = append(results, ps.evaluate(fallback, &msg))
 	}
 
+	for _, result := range results {
+		if err := enc.Encode(result); err != nil {
+			// TODO
+		}
+	}
 }
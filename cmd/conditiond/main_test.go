@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes files with the given contents to dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// newTestProfiles loads and validates a configuration and creates its
+// profiles.
+func newTestProfiles(t *testing.T, config string) profiles {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeFiles(t, filepath.Dir(path), map[string]string{"config.json": config})
+
+	cfg, err := GetConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ps, err := newProfiles(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ps
+}
+
+// testConfig returns a configuration with a default profile using policies
+// from policyDir and a restricted profile.
+func testConfig(policyDir string) string {
+	return fmt.Sprintf(`{
+		"evaluator": {"policy_dir": %q, "limits": {"max_calls": 10}},
+		"profiles": {
+			"restricted": {
+				"func_whitelist": ["eq", "context"],
+				"context_deny": ["secret"],
+				"limits": {"max_condition_bytes": 100, "max_depth": 5}
+			}
+		}
+	}`, policyDir)
+}
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	policyDir := t.TempDir()
+	writeFiles(t, policyDir, map[string]string{
+		"adult.json": `{"gte": [{"context": "age"}, 18]}`,
+	})
+
+	server := httptest.NewServer(newServeMux(newTestProfiles(t, testConfig(policyDir))))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// decodeResults decodes a stream of evaluation results.
+func decodeResults(t *testing.T, resp *http.Response) []EvaluationResult {
+	t.Helper()
+
+	results := []EvaluationResult{}
+	dec := json.NewDecoder(resp.Body)
+	for dec.More() {
+		result := EvaluationResult{}
+		if err := dec.Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+func TestServeEvaluate(t *testing.T) {
+	server := newTestServer(t)
+
+	tests := []struct {
+		path     string
+		messages string
+		results  []interface{}
+		errors   []string
+	}{
+		{
+			path: "/evaluate",
+			messages: `{"condition": {"gt": [{"context": "n"}, 1]}, "context": {"n": 2}}
+				{"policy": "adult", "context": {"age": 17}}
+				{"condition": {"eq": [{"context": "n"}, 1]}, "context": {"n": 1}, "profile": "restricted"}
+				{"condition": true, "profile": "missing"}`,
+			results: []interface{}{true, false, true, nil},
+			errors:  []string{"", "", "", `unknown profile "missing"`},
+		},
+		{
+			path: "/profiles/restricted/evaluate",
+			messages: `{"condition": {"eq": [{"context": "n"}, 1]}, "context": {"n": 1}}
+				{"condition": {"gt": [{"context": "n"}, 1]}, "context": {"n": 2}}
+				{"condition": {"eq": [{"context": "secret"}, 1]}, "context": {"secret": 1}}
+				{"condition": true, "profile": "default"}
+				{"condition": true, "profile": "restricted"}`,
+			results: []interface{}{true, nil, nil, nil, true},
+			errors: []string{
+				"",
+				`no expression handler bound to "gt"`,
+				"context path [secret] is not allowed",
+				`message profile "default" does not match profile "restricted"`,
+				"",
+			},
+		},
+		{
+			path:     "/profiles/default/evaluate",
+			messages: `{"policy": "adult", "context": {"age": 18}}`,
+			results:  []interface{}{true},
+			errors:   []string{""},
+		},
+	}
+
+	for _, test := range tests {
+		resp, err := http.Post(server.URL+test.path, "application/json", strings.NewReader(test.messages))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		results := decodeResults(t, resp)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK || len(results) != len(test.results) {
+			t.Fatalf("%s: unexpected response %d %+v", test.path, resp.StatusCode, results)
+		}
+
+		for i, result := range results {
+			if result.Result != test.results[i] {
+				t.Errorf("%s message %d: expected %v got %v", test.path, i, test.results[i], result.Result)
+			}
+
+			if test.errors[i] == "" {
+				if result.Error != nil {
+					t.Errorf("%s message %d: unexpected error %s", test.path, i, *result.Error)
+				}
+			} else if result.Error == nil || !strings.Contains(*result.Error, test.errors[i]) {
+				t.Errorf("%s message %d: expected error containing %q got %v", test.path, i, test.errors[i], result.Error)
+			}
+		}
+	}
+}
+
+func TestServeEvaluateStatus(t *testing.T) {
+	server := newTestServer(t)
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{method: http.MethodGet, path: "/evaluate", status: http.StatusMethodNotAllowed},
+		{method: http.MethodPost, path: "/evaluate", body: `{"condition": `, status: http.StatusBadRequest},
+		{method: http.MethodPost, path: "/profiles/missing/evaluate", body: `{"condition": true}`, status: http.StatusNotFound},
+		{method: http.MethodPost, path: "/profiles/restricted", body: `{"condition": true}`, status: http.StatusNotFound},
+		{method: http.MethodPost, path: "/profiles/restricted/unknown", body: `{"condition": true}`, status: http.StatusNotFound},
+		{method: http.MethodGet, path: "/ping", status: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest(test.method, server.URL+test.path, strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != test.status {
+			t.Errorf("%s %s: expected status %d got %d", test.method, test.path, test.status, resp.StatusCode)
+		}
+	}
+}
+
+func TestServeFunctions(t *testing.T) {
+	server := newTestServer(t)
+
+	tests := []struct {
+		path   string
+		status int
+		names  []string
+	}{
+		{path: "/functions?profile=restricted", status: http.StatusOK, names: []string{"context", "eq"}},
+		{path: "/profiles/restricted/functions", status: http.StatusOK, names: []string{"context", "eq"}},
+		{path: "/functions?profile=missing", status: http.StatusNotFound},
+		{path: "/profiles/missing/functions", status: http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		resp, err := http.Get(server.URL + test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		functions := []struct {
+			Name string `json:"name"`
+		}{}
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&functions); err != nil {
+				t.Fatal(err)
+			}
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: expected status %d got %d", test.path, test.status, resp.StatusCode)
+			continue
+		}
+
+		names := []string{}
+		for _, f := range functions {
+			names = append(names, f.Name)
+		}
+		if test.names != nil && !reflect.DeepEqual(names, test.names) {
+			t.Errorf("%s: expected %v got %v", test.path, test.names, names)
+		}
+	}
+
+	// The default profile enables all functions.
+	resp, err := http.Get(server.URL + "/functions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	functions := []struct {
+		Name string `json:"name"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&functions); err != nil {
+		t.Fatal(err)
+	}
+	if len(functions) < 10 {
+		t.Errorf("expected all functions, got %v", functions)
+	}
+}
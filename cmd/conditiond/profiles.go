@@ -0,0 +1,327 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/tadasv/conditiond"
+)
+
+// profile evaluates conditions with evaluators built from a single profile
+// configuration.
+type profile struct {
+	name      string
+	limits    LimitsConfig
+	functions []FunctionInfo
+	policies  map[string]*condition.Node
+
+	// contextPolicy restricts context paths read by conditions, readers are
+	// names of functions that read the context.
+	contextPolicy *condition.ContextPolicy
+	readers       []string
+
+	// evaluators holds idle evaluators built from template. Evaluators are
+	// not safe for concurrent use, every evaluation takes one from the pool
+	// or builds a new one.
+	template   *evaluatorTemplate
+	evaluators sync.Pool
+}
+
+// profileEvaluator is an evaluator with the state of its current evaluation.
+type profileEvaluator struct {
+	evaluator *condition.Evaluator
+	maxCalls  int
+
+	// calls counts function calls of the current evaluation.
+	calls int
+}
+
+func newProfile(name string, cfg *EvaluatorConfig) (*profile, error) {
+	template, err := newEvaluatorTemplate(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	policies := map[string]*condition.Node{}
+	if cfg.PolicyDir != "" {
+		policies, err = loadPolicies(cfg.PolicyDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	contextPolicy, err := cfg.contextPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	functions := enabledFunctions(cfg)
+	optimizer := optimizerRegistry(functions)
+	for name, root := range policies {
+		policies[name] = optimizer.Optimize(root)
+	}
+	p := &profile{
+		name:          name,
+		limits:        cfg.Limits,
+		functions:     functions,
+		policies:      policies,
+		contextPolicy: contextPolicy,
+		readers:       contextReaders(functions),
+		template:      template,
+	}
+
+	// Build the first evaluator now, so that configuration errors are
+	// reported when the profile is created.
+	pe, err := p.newEvaluator()
+	if err != nil {
+		return nil, err
+	}
+	p.evaluators.Put(pe)
+
+	return p, nil
+}
+
+func (p *profile) newEvaluator() (*profileEvaluator, error) {
+	evaluator, err := p.template.newEvaluator()
+	if err != nil {
+		return nil, err
+	}
+
+	pe := &profileEvaluator{
+		evaluator: evaluator,
+		maxCalls:  p.limits.MaxCalls,
+	}
+
+	if p.contextPolicy != nil {
+		evaluator.SetContextPolicy(p.contextPolicy)
+	}
+
+	if pe.maxCalls > 0 {
+		evaluator.Use(pe.limitCalls)
+	}
+
+	return pe, nil
+}
+
+// limitCalls is an interceptor that fails function calls after the call limit
+// is reached.
+func (pe *profileEvaluator) limitCalls(next condition.ExpressionFunc) condition.ExpressionFunc {
+	return func(e *condition.Evaluator, n *condition.Node) (interface{}, error) {
+		pe.calls++
+		if pe.calls > pe.maxCalls {
+			return nil, &condition.EvaluationError{
+				Kind:    condition.ErrorKindLimit,
+				Message: fmt.Sprintf("call limit of %d exceeded", pe.maxCalls),
+			}
+		}
+		return next(e, n)
+	}
+}
+
+// root returns the condition of a message. It is either a policy or a
+// condition sent in the message, which must be within limits.
+func (p *profile) root(msg *ConditionMessage) (*condition.Node, error) {
+	if msg.Policy != "" {
+		if len(msg.Condition) > 0 {
+			return nil, fmt.Errorf("message must have either condition or policy set")
+		}
+
+		root, ok := p.policies[msg.Policy]
+		if !ok {
+			return nil, fmt.Errorf("unknown policy %q", msg.Policy)
+		}
+		return root, nil
+	}
+
+	if max := p.limits.MaxConditionBytes; max > 0 && len(msg.Condition) > max {
+		return nil, fmt.Errorf("condition is larger than %d bytes", max)
+	}
+
+	root, err := condition.Parse(string(msg.Condition))
+	if err != nil {
+		return nil, err
+	}
+
+	if max := p.limits.MaxDepth; max > 0 && nodeDepth(root) > max {
+		return nil, fmt.Errorf("condition is nested deeper than %d levels", max)
+	}
+
+	if p.contextPolicy != nil {
+		if err := p.contextPolicy.CheckCondition(root, p.readers...); err != nil {
+			return nil, err
+		}
+	}
+
+	return root, nil
+}
+
+func (p *profile) evaluate(msg *ConditionMessage) (interface{}, []condition.TraceEntry, error) {
+	root, err := p.root(msg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pe, ok := p.evaluators.Get().(*profileEvaluator)
+	if !ok {
+		pe, err = p.newEvaluator()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	defer p.evaluators.Put(pe)
+
+	options := pe.evaluator.Options()
+	if msg.Strict != nil {
+		options.Strict = *msg.Strict
+	}
+
+	pe.calls = 0
+	result, err := pe.evaluator.EvaluateWithOptions(msg.Context, root, options)
+	return result, pe.evaluator.Trace(), err
+}
+
+// optimizerRegistry returns a registry of enabled functions that are called by
+// their registry names. Renamed functions and macros are left out, so that
+// the optimizer doesn't treat them as the functions with the same name.
+func optimizerRegistry(functions []FunctionInfo) *condition.Registry {
+	registry := condition.NewRegistry()
+	for _, f := range functions {
+		if !f.Macro && f.Name == f.Function {
+			registry.MustRegister(f.Name, f.FunctionSpec)
+		}
+	}
+
+	return registry
+}
+
+// contextReaders returns names of enabled functions that read the context.
+func contextReaders(functions []FunctionInfo) []string {
+	readers := []string{}
+	for _, f := range functions {
+		if !f.Macro && (f.Function == "context" || f.Function == "exists") {
+			readers = append(readers, f.Name)
+		}
+	}
+
+	return readers
+}
+
+// nodeDepth returns the nesting depth of objects and arrays in a condition.
+// Literals have depth 0.
+func nodeDepth(n *condition.Node) int {
+	if n.Type == condition.NodeTypeLiteral {
+		return 0
+	}
+
+	depth := 0
+	for _, child := range n.Children {
+		if d := nodeDepth(child); d > depth {
+			depth = d
+		}
+	}
+
+	return depth + 1
+}
+
+// loadPolicies parses all *.json files in dir and checks that they only
+// reference bound variables. Policies are named after the file without the
+// extension.
+func loadPolicies(dir string) (map[string]*condition.Node, error) {
+	files, err := policyFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	policies := map[string]*condition.Node{}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		root, err := condition.Parse(string(data))
+		if err == nil {
+			err = condition.CheckVariables(root)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("policy %q: %s", name, err.Error())
+		}
+		policies[name] = root
+	}
+
+	return policies, nil
+}
+
+// policyFiles returns paths of *.json files in dir.
+func policyFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		files = append(files, filepath.Join(dir, entry.Name()))
+	}
+
+	return files, nil
+}
+
+// profiles maps profile names to profiles.
+type profiles map[string]*profile
+
+func newProfiles(cfg *Config) (profiles, error) {
+	ps := profiles{}
+	for _, name := range cfg.profileNames() {
+		profileCfg, _ := cfg.profileConfig(name)
+		p, err := newProfile(name, profileCfg)
+		if err != nil {
+			return nil, fmt.Errorf("profile %q: %s", name, err.Error())
+		}
+		ps[name] = p
+	}
+
+	return ps, nil
+}
+
+// evaluate evaluates a message with the profile it selects, or with the
+// fallback profile if it doesn't select one.
+func (ps profiles) evaluate(fallback string, msg *ConditionMessage) EvaluationResult {
+	name := msg.Profile
+	if name == "" {
+		name = fallback
+	}
+
+	p, ok := ps[name]
+	if !ok {
+		return errorResult(fmt.Errorf("unknown profile %q", name))
+	}
+
+	value, trace, err := p.evaluate(msg)
+	resultMsg := EvaluationResult{
+		Result: value,
+	}
+	if msg.Trace {
+		resultMsg.Trace = trace
+	}
+	if err != nil {
+		errMsg := err.Error()
+		resultMsg.Error = &errMsg
+	}
+
+	return resultMsg
+}
+
+func errorResult(err error) EvaluationResult {
+	errMsg := err.Error()
+	return EvaluationResult{
+		Error: &errMsg,
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tadasv/conditiond"
+)
+
+func TestNodeDepth(t *testing.T) {
+	tests := []struct {
+		expression string
+		depth      int
+	}{
+		{expression: `true`, depth: 0},
+		{expression: `[]`, depth: 1},
+		{expression: `[1, [2]]`, depth: 2},
+		{expression: `{"context": "a"}`, depth: 1},
+		{expression: `{"context": ["a"]}`, depth: 2},
+		{expression: `{"and": [{"not": {"context": "a"}}, true]}`, depth: 4},
+	}
+
+	for _, test := range tests {
+		root, err := condition.Parse(test.expression)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if depth := nodeDepth(root); depth != test.depth {
+			t.Errorf("%s: expected depth %d got %d", test.expression, test.depth, depth)
+		}
+	}
+}
+
+func TestLoadPolicies(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"adult.json":   `{"gte": [{"context": "age"}, 18]}`,
+		"enabled.json": `true`,
+		"notes.txt":    `not a policy`,
+	})
+	if err := os.Mkdir(filepath.Join(dir, "nested.json"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	policies, err := loadPolicies(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{"adult", "enabled"}) {
+		t.Errorf("unexpected policies %v", names)
+	}
+
+	writeFiles(t, dir, map[string]string{"broken.json": `{"and": [], "or": []}`})
+	if _, err := loadPolicies(dir); err == nil || !strings.Contains(err.Error(), `policy "broken"`) {
+		t.Errorf("expected an error for the broken policy, got %v", err)
+	}
+
+	writeFiles(t, dir, map[string]string{"broken.json": `{"let": [{"a": 1}, {"var": "b"}]}`})
+	if _, err := loadPolicies(dir); err == nil || !strings.Contains(err.Error(), `undefined variable "b"`) {
+		t.Errorf("expected an error for the unbound variable, got %v", err)
+	}
+
+	if _, err := loadPolicies(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("expected an error for a missing directory")
+	}
+}
+
+func TestValidateMacroContextReads(t *testing.T) {
+	tests := []struct {
+		body  string
+		valid bool
+	}{
+		{body: `{"eq": [{"context": "user.email"}, {"var": "value"}]}`, valid: true},
+		{body: `{"eq": [{"context": "user.ssn"}, {"var": "value"}]}`, valid: false},
+		{body: `{"exists": ["user", {"var": "value"}]}`, valid: false},
+	}
+
+	for _, test := range tests {
+		cfg := EvaluatorConfig{
+			ContextDeny: []string{"user.ssn"},
+			Macros: map[string]MacroConfig{
+				"check": {Params: []string{"value"}, Body: []byte(test.body)},
+			},
+		}
+		cfg.FunctionMap = defaultFunctionMap(cfg.Macros)
+
+		err := cfg.Validate()
+		if test.valid && err != nil {
+			t.Errorf("%s: unexpected error %s", test.body, err.Error())
+		} else if !test.valid && (err == nil || !strings.Contains(err.Error(), `macro "check"`)) {
+			t.Errorf("%s: expected a macro error, got %v", test.body, err)
+		}
+	}
+}
+
+// evaluateMessage evaluates a message with the default profile.
+func evaluateMessage(t *testing.T, ps profiles, msg string) EvaluationResult {
+	t.Helper()
+
+	m := ConditionMessage{}
+	if err := json.Unmarshal([]byte(msg), &m); err != nil {
+		t.Fatal(err)
+	}
+
+	return ps.evaluate(defaultProfile, &m)
+}
+
+func TestProfileLimits(t *testing.T) {
+	ps := newTestProfiles(t, `{
+		"evaluator": {"limits": {"max_condition_bytes": 60, "max_depth": 4, "max_calls": 3}}
+	}`)
+
+	tests := []struct {
+		msg string
+		err string
+	}{
+		{msg: `{"condition": {"not": {"not": {"not": {"not": {"not": true}}}}}}`, err: "nested deeper than 4 levels"},
+		{msg: `{"condition": {"or": [false, false, false, false, false, false, false, true]}}`, err: "larger than 60 bytes"},
+		{msg: `{"condition": {"and": [{"not": false}, {"not": false}]}}`, err: ""},
+		{msg: `{"condition": {"and": [{"not": false}, {"not": false}, {"not": false}]}}`, err: "call limit of 3 exceeded"},
+	}
+
+	for _, test := range tests {
+		// Every message is evaluated twice, the call count must not carry
+		// over from previous evaluations.
+		for i := 0; i < 2; i++ {
+			result := evaluateMessage(t, ps, test.msg)
+			if test.err == "" {
+				if result.Error != nil {
+					t.Errorf("%s: unexpected error %s", test.msg, *result.Error)
+				}
+			} else if result.Error == nil || !strings.Contains(*result.Error, test.err) {
+				t.Errorf("%s: expected error containing %q got %v", test.msg, test.err, result.Error)
+			}
+		}
+	}
+}
+
+func TestCallLimitNotCaught(t *testing.T) {
+	ps := newTestProfiles(t, `{"evaluator": {"limits": {"max_calls": 3}}}`)
+
+	for _, msg := range []string{
+		`{"condition": {"try": [{"or": [{"context": "a"}, {"context": "b"}]}, true]}, "context": {}}`,
+		`{"condition": {"try": [{"or": [{"context": "a"}, {"context": "b"}]}, true, "limit"]}, "context": {}}`,
+	} {
+		result := evaluateMessage(t, ps, msg)
+		if result.Error == nil || !strings.Contains(*result.Error, "call limit of 3 exceeded") {
+			t.Errorf("%s: expected call limit error, got %v", msg, result.Result)
+		}
+	}
+}
+
+func TestLimitCalls(t *testing.T) {
+	pe := &profileEvaluator{maxCalls: 2}
+	handler := pe.limitCalls(func(e *condition.Evaluator, n *condition.Node) (interface{}, error) {
+		return true, nil
+	})
+
+	for i := 0; i < 2; i++ {
+		if _, err := handler(nil, nil); err != nil {
+			t.Fatalf("call %d: unexpected error %s", i, err.Error())
+		}
+	}
+
+	if _, err := handler(nil, nil); err == nil {
+		t.Errorf("expected the third call to fail")
+	}
+
+	pe.calls = 0
+	if _, err := handler(nil, nil); err != nil {
+		t.Errorf("expected calls to be allowed after reset, got %s", err.Error())
+	}
+}
+
+func TestProfileConcurrentEvaluation(t *testing.T) {
+	ps := newTestProfiles(t, `{"evaluator": {"limits": {"max_calls": 3}}}`)
+
+	// Every message makes exactly three calls. Call counts of concurrent
+	// evaluations must not be shared.
+	msg := `{"condition": {"and": [{"eq": [{"context": "n"}, 1]}]}, "context": {"n": 1}}`
+
+	wg := sync.WaitGroup{}
+	errs := make(chan string, 50)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m := ConditionMessage{}
+			if err := json.Unmarshal([]byte(msg), &m); err != nil {
+				errs <- err.Error()
+				return
+			}
+
+			result := ps.evaluate(defaultProfile, &m)
+			if result.Error != nil {
+				errs <- *result.Error
+			} else if result.Result != true {
+				errs <- "unexpected result"
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestNewProfileErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"broken.json": `{"and": [], "or": []}`})
+
+	configs := []EvaluatorConfig{
+		{PolicyDir: dir},
+		{PolicyDir: filepath.Join(dir, "missing")},
+		{Truthiness: "sometimes"},
+		{Resolvers: map[string]ResolverConfig{"account": {File: filepath.Join(dir, "missing.json")}}},
+		{Macros: map[string]MacroConfig{"adult": {Params: []string{"age"}, Body: []byte(`{"gte": [{"var": "agee"}, 18]}`)}}},
+	}
+
+	for _, cfg := range configs {
+		cfg.FunctionMap = defaultFunctionMap(cfg.Macros)
+		if _, err := newProfile("test", &cfg); err == nil {
+			t.Errorf("expected an error for %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package condition
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// ContextPolicy restricts context paths that conditions can read. Paths are
+// checked against prefixes written as JSON Pointers or dotted paths, e.g.
+// "user.email" or "/user/email". A "*" prefix element matches any path
+// element.
+//
+// A path is denied if it can read a value under a deny prefix. This includes
+// parents of denied paths, e.g. "user" is denied by "user.email", and paths
+// with wildcards, e.g. "user.*". If allow prefixes are set, a path must also
+// be under one of them.
+type ContextPolicy struct {
+	allow [][]string
+	deny  [][]string
+}
+
+// NewContextPolicy creates a policy from allow and deny prefixes. An empty
+// allow list allows every path that is not denied.
+func NewContextPolicy(allow, deny []string) (*ContextPolicy, error) {
+	p := &ContextPolicy{}
+
+	for _, prefix := range allow {
+		elements, err := parsePathPrefix(prefix)
+		if err != nil {
+			return nil, err
+		}
+		p.allow = append(p.allow, elements)
+	}
+
+	for _, prefix := range deny {
+		elements, err := parsePathPrefix(prefix)
+		if err != nil {
+			return nil, err
+		}
+		p.deny = append(p.deny, elements)
+	}
+
+	return p, nil
+}
+
+func parsePathPrefix(prefix string) ([]string, error) {
+	path, err := parsePathString(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	// Prefix elements are compared with canonical array indexes, so indexes
+	// written differently would never match.
+	elements := make([]string, len(path))
+	for i, element := range path {
+		elements[i], _ = pathKey(element)
+		if _, err := strconv.Atoi(elements[i]); err == nil && tokenString(elements[i]) != elements[i] {
+			return nil, fmt.Errorf("path prefix %q has non-canonical array index %q", prefix, elements[i])
+		}
+	}
+
+	return elements, nil
+}
+
+// maxIndex is the largest array index that selects the same element on every
+// platform.
+const maxIndex = math.MaxInt32
+
+// pathStrings converts path elements to strings that can be compared with
+// prefix elements. Array indexes are converted to the decimal form of the
+// element they select. Indexes that select an element depending on the length
+// of the array, i.e. negative ones, and indexes written in other forms, e.g.
+// "00", "+0" or 0.5, are converted to wildcards.
+func pathStrings(path []interface{}) []string {
+	elements := make([]string, len(path))
+	for i, element := range path {
+		switch v := element.(type) {
+		case string:
+			elements[i] = v
+		case pathToken:
+			elements[i] = tokenString(string(v))
+		case float64:
+			elements[i] = wildcard
+			if v >= 0 && v <= maxIndex && v == math.Trunc(v) {
+				elements[i] = strconv.Itoa(int(v))
+			}
+		default:
+			elements[i] = fmt.Sprint(element)
+		}
+	}
+
+	return elements
+}
+
+// tokenString returns a path token, or a wildcard if the token is used as an
+// array index that isn't written in decimal form without a sign or leading
+// zeros. Such tokens are object keys too, so they may also read the key.
+func tokenString(token string) string {
+	index, err := strconv.Atoi(token)
+	if err != nil {
+		return token
+	}
+
+	if index < 0 || index > maxIndex || strconv.Itoa(index) != token {
+		return wildcard
+	}
+
+	return token
+}
+
+// Check returns a forbidden error if the policy does not allow reading path.
+func (p *ContextPolicy) Check(path []interface{}) error {
+	elements := pathStrings(path)
+
+	for _, prefix := range p.deny {
+		if overlaps(prefix, elements) {
+			return newError(ErrorKindForbidden, "context path %v is not allowed", path)
+		}
+	}
+
+	if len(p.allow) == 0 {
+		return nil
+	}
+
+	for _, prefix := range p.allow {
+		if underPrefix(prefix, elements) {
+			return nil
+		}
+	}
+
+	return newError(ErrorKindForbidden, "context path %v is not allowed", path)
+}
+
+// underPrefix returns true if every value read by path is under prefix.
+func underPrefix(prefix, path []string) bool {
+	if len(path) < len(prefix) {
+		return false
+	}
+
+	for i := range prefix {
+		if prefix[i] != wildcard && prefix[i] != path[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// overlaps returns true if path can read a value under prefix.
+func overlaps(prefix, path []string) bool {
+	for i := 0; i < len(prefix) && i < len(path); i++ {
+		if prefix[i] != wildcard && path[i] != wildcard && prefix[i] != path[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CheckCondition statically checks context paths read by a condition. The
+// functions are names of functions that read the context, usually context
+// and exists. Path elements that are not literals are treated as wildcards
+// and paths that are not literal at all as reads of the whole context, so
+// paths that can't be proven allowed are rejected. Macro bodies are not
+// checked, check them separately or rely on checks during evaluation.
+func (p *ContextPolicy) CheckCondition(root *Node, functions ...string) error {
+	readers := map[string]bool{}
+	for _, name := range functions {
+		readers[name] = true
+	}
+
+	return p.checkNode(root, readers)
+}
+
+func (p *ContextPolicy) checkNode(n *Node, readers map[string]bool) error {
+	if n.Type == NodeTypeFunction && readers[FunctionName(n)] && len(n.Children) > 0 {
+		if err := p.Check(staticContextPath(n.Children[0])); err != nil {
+			return err
+		}
+	}
+
+	for _, child := range n.Children {
+		if err := p.checkNode(child, readers); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// staticContextPath returns the path read by a context path argument with
+// non-literal elements replaced by wildcards.
+func staticContextPath(params *Node) []interface{} {
+	if params.Type != NodeTypeArray {
+		if str, ok := params.Token.Value.(string); ok && params.Type == NodeTypeLiteral {
+			if path, err := parsePathString(str); err == nil {
+				return path
+			}
+		}
+		return []interface{}{}
+	}
+
+	path := make([]interface{}, len(params.Children))
+	for i, child := range params.Children {
+		path[i] = wildcard
+		if child.Type == NodeTypeLiteral {
+			path[i] = child.Token.Value
+		}
+	}
+
+	return path
+}
+
+// SetContextPolicy restricts context paths read by the context and exists
+// expressions. A nil policy allows every path.
+func (e *Evaluator) SetContextPolicy(p *ContextPolicy) {
+	e.contextPolicy = p
+}
+
+// checkContextPath returns an error if the context policy does not allow
+// reading path.
+func (e *Evaluator) checkContextPath(path []interface{}) error {
+	if e.contextPolicy == nil {
+		return nil
+	}
+
+	return e.contextPolicy.Check(path)
+}
@@ -0,0 +1,196 @@
+package condition
+
+import (
+	"testing"
+)
+
+func TestContextPolicy(t *testing.T) {
+	policy, err := NewContextPolicy([]string{"user", "/items/*/price", "region"}, []string{"user.email", "user.ssn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := map[string]interface{}{
+		"user": map[string]interface{}{
+			"name":  "ann",
+			"email": "ann@example.com",
+		},
+		"items": []interface{}{
+			map[string]interface{}{"price": 3.0, "sku": "a"},
+		},
+		"region": "eu",
+		"secret": "s",
+	}
+
+	tests := []struct {
+		expression string
+		allowed    bool
+	}{
+		{expression: `{"context": ["user", "name"]}`, allowed: true},
+		{expression: `{"context": "user.name"}`, allowed: true},
+		{expression: `{"context": "/region"}`, allowed: true},
+		{expression: `{"context": ["items", 0, "price"]}`, allowed: true},
+		{expression: `{"context": "items.*.price"}`, allowed: true},
+		{expression: `{"exists": ["user", "name"]}`, allowed: true},
+		{expression: `{"context": ["user", "email"]}`, allowed: false},
+		{expression: `{"context": "/user/ssn"}`, allowed: false},
+		{expression: `{"context": ["user"]}`, allowed: false},
+		{expression: `{"context": ["user", "*"]}`, allowed: false},
+		{expression: `{"context": []}`, allowed: false},
+		{expression: `{"context": ["secret"]}`, allowed: false},
+		{expression: `{"context": ["items", 0, "sku"]}`, allowed: false},
+		{expression: `{"context": ["items", "*"]}`, allowed: false},
+		{expression: `{"exists": ["user", "email"]}`, allowed: false},
+	}
+
+	evaluator := NewDefaultEvaluator()
+	evaluator.SetContextPolicy(policy)
+
+	for _, test := range tests {
+		root := mustParse(t, test.expression)
+
+		_, err := evaluator.Evaluate(ctx, root)
+		if test.allowed && err != nil {
+			t.Errorf("%s: unexpected error: %s", test.expression, err.Error())
+		} else if !test.allowed && ErrorKindOf(err) != ErrorKindForbidden {
+			t.Errorf("%s: expected forbidden error, got %v", test.expression, err)
+		}
+
+		err = policy.CheckCondition(root, "context", "exists")
+		if test.allowed && err != nil {
+			t.Errorf("%s: unexpected static error: %s", test.expression, err.Error())
+		} else if !test.allowed && ErrorKindOf(err) != ErrorKindForbidden {
+			t.Errorf("%s: expected static forbidden error, got %v", test.expression, err)
+		}
+	}
+}
+
+func TestContextPolicyDenyOnly(t *testing.T) {
+	policy, err := NewContextPolicy(nil, []string{"user.email"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evaluator := NewDefaultEvaluator()
+	evaluator.SetContextPolicy(policy)
+
+	ctx := map[string]interface{}{"user": map[string]interface{}{"name": "ann"}, "region": "eu"}
+	res, err := evaluator.Evaluate(ctx, mustParse(t, `{"context": "region"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "eu" {
+		t.Errorf("expected eu got %v", res)
+	}
+
+	// Forbidden reads are errors even when the value is missing.
+	_, err = evaluator.Evaluate(map[string]interface{}{}, mustParse(t, `{"context": "user.email"}`))
+	if ErrorKindOf(err) != ErrorKindForbidden {
+		t.Errorf("expected forbidden error, got %v", err)
+	}
+}
+
+func TestContextPolicyCheckCondition(t *testing.T) {
+	policy, err := NewContextPolicy(nil, []string{"user.email"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		expression string
+		allowed    bool
+	}{
+		// Nested reads are checked.
+		{expression: `{"and": [{"eq": [{"context": "region"}, "eu"]}, {"context": "user.email"}]}`, allowed: false},
+		// Computed path elements may refer to the denied key.
+		{expression: `{"context": ["user", {"var": "key"}]}`, allowed: false},
+		{expression: `{"context": ["region", {"var": "key"}]}`, allowed: true},
+		// Computed paths may read anything.
+		{expression: `{"context": {"var": "path"}}`, allowed: false},
+		// Only listed functions read the context.
+		{expression: `{"get": [{"context": "region"}, "user.email"]}`, allowed: true},
+		{expression: `{"ctx": "user.email"}`, allowed: false},
+	}
+
+	for _, test := range tests {
+		err := policy.CheckCondition(mustParse(t, test.expression), "context", "ctx")
+		if test.allowed && err != nil {
+			t.Errorf("%s: unexpected error: %s", test.expression, err.Error())
+		} else if !test.allowed && err == nil {
+			t.Errorf("%s: expected error", test.expression)
+		}
+	}
+}
+
+func TestContextPolicyArrayIndexes(t *testing.T) {
+	policy, err := NewContextPolicy(nil, []string{"items.0.secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"secret": "s", "name": "a"},
+		},
+	}
+
+	tests := []struct {
+		expression string
+		allowed    bool
+	}{
+		{expression: `{"context": ["items", 0, "secret"]}`, allowed: false},
+		{expression: `{"context": ["items", 0.5, "secret"]}`, allowed: false},
+		{expression: `{"context": ["items", -1, "secret"]}`, allowed: false},
+		{expression: `{"context": ["items", -0.5, "secret"]}`, allowed: false},
+		{expression: `{"context": ["items", 1e300, "secret"]}`, allowed: false},
+		{expression: `{"context": "items.0.secret"}`, allowed: false},
+		{expression: `{"context": "items.00.secret"}`, allowed: false},
+		{expression: `{"context": "items.+0.secret"}`, allowed: false},
+		{expression: `{"context": "items.-0.secret"}`, allowed: false},
+		{expression: `{"context": "items.-1.secret"}`, allowed: false},
+		{expression: `{"context": "/items/00/secret"}`, allowed: false},
+		{expression: `{"exists": "items.00.secret"}`, allowed: false},
+		{expression: `{"context": ["items", 0, "name"]}`, allowed: true},
+		{expression: `{"context": "items.-1.name"}`, allowed: true},
+		{expression: `{"context": ["items", 1, "secret"]}`, allowed: true},
+	}
+
+	evaluator := NewDefaultEvaluator()
+	evaluator.SetContextPolicy(policy)
+
+	for _, test := range tests {
+		root := mustParse(t, test.expression)
+
+		res, err := evaluator.Evaluate(ctx, root)
+		if test.allowed && err != nil {
+			t.Errorf("%s: unexpected error: %s", test.expression, err.Error())
+		} else if !test.allowed && ErrorKindOf(err) != ErrorKindForbidden {
+			t.Errorf("%s: expected forbidden error, got %v, %v", test.expression, res, err)
+		}
+
+		err = policy.CheckCondition(root, "context", "exists")
+		if test.allowed && err != nil {
+			t.Errorf("%s: unexpected static error: %s", test.expression, err.Error())
+		} else if !test.allowed && ErrorKindOf(err) != ErrorKindForbidden {
+			t.Errorf("%s: expected static forbidden error, got %v", test.expression, err)
+		}
+	}
+
+	// Computed indexes are checked during evaluation.
+	root := mustParse(t, `{"let": [{"i": 0.5}, {"context": ["items", {"var": "i"}, "secret"]}]}`)
+	if _, err := evaluator.Evaluate(ctx, root); ErrorKindOf(err) != ErrorKindForbidden {
+		t.Errorf("expected forbidden error for a computed index, got %v", err)
+	}
+}
+
+func TestContextPolicyInvalidPrefix(t *testing.T) {
+	prefixes := []string{"/user/~2", "items.00", "items.+1", "items.-1", "/items/-0"}
+	for _, prefix := range prefixes {
+		if _, err := NewContextPolicy([]string{prefix}, nil); err == nil {
+			t.Errorf("%s: expected error", prefix)
+		}
+		if _, err := NewContextPolicy(nil, []string{prefix}); err == nil {
+			t.Errorf("%s: expected error", prefix)
+		}
+	}
+}
@@ -1,13 +1,7 @@
 package condition
 
 // NewDefaultEvaluator create a new evaluator with handler for all expressions
-// in the expression registry.
+// in the default registry.
 func NewDefaultEvaluator() *Evaluator {
-	evaluator := NewEvaluator()
-
-	for key, handler := range ExpressionRegistry {
-		evaluator.AddHandler(key, handler)
-	}
-
-	return evaluator
+	return DefaultRegistry.NewEvaluator()
 }
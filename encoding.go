@@ -0,0 +1,156 @@
+package condition
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// evaluateStringArg evaluates the only argument of a function as a string.
+func evaluateStringArg(e *Evaluator, n *Node) (string, error) {
+	args := NewArgs(e, n)
+	return args.String(0)
+}
+
+// Base64EncodeExpressionHandler returns the standard, padded base64 encoding
+// of a string.
+func Base64EncodeExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	value, err := evaluateStringArg(e, n)
+	if err != nil {
+		return nil, err
+	}
+
+	return base64.StdEncoding.EncodeToString([]byte(value)), nil
+}
+
+// Base64DecodeExpressionHandler decodes a base64 encoded string. Standard and
+// URL safe alphabets are accepted, with or without padding. The decoded value
+// must be valid UTF-8.
+func Base64DecodeExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	value, err := evaluateStringArg(e, n)
+	if err != nil {
+		return nil, err
+	}
+
+	encoding := base64.RawStdEncoding
+	if strings.ContainsAny(value, "-_") {
+		encoding = base64.RawURLEncoding
+	}
+
+	decoded, err := encoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil {
+		return nil, newError(ErrorKindValue, "invalid base64 value: %s", err.Error())
+	}
+
+	if !utf8.Valid(decoded) {
+		return nil, newError(ErrorKindValue, "decoded base64 value is not valid UTF-8")
+	}
+
+	return string(decoded), nil
+}
+
+// URLDecodeExpressionHandler decodes a percent encoded string. Plus signs are
+// decoded as spaces.
+func URLDecodeExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	value, err := evaluateStringArg(e, n)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, err := url.QueryUnescape(value)
+	if err != nil {
+		return nil, newError(ErrorKindValue, "invalid URL encoded value: %s", err.Error())
+	}
+
+	return decoded, nil
+}
+
+// URLParseExpressionHandler parses a URL into an object with scheme, host,
+// hostname, port, path, query and fragment keys. Query is an object mapping
+// parameter names to their first value.
+func URLParseExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	value, err := evaluateStringArg(e, n)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return nil, newError(ErrorKindValue, "invalid URL: %s", err.Error())
+	}
+
+	query := map[string]interface{}{}
+	for key, values := range parsed.Query() {
+		query[key] = values[0]
+	}
+
+	return map[string]interface{}{
+		"scheme":   parsed.Scheme,
+		"host":     parsed.Host,
+		"hostname": parsed.Hostname(),
+		"port":     parsed.Port(),
+		"path":     parsed.Path,
+		"query":    query,
+		"fragment": parsed.Fragment,
+	}, nil
+}
+
+// Sha256ExpressionHandler returns the hex encoded SHA-256 digest of a string.
+func Sha256ExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	value, err := evaluateStringArg(e, n)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Md5ExpressionHandler returns the hex encoded MD5 digest of a string.
+func Md5ExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	value, err := evaluateStringArg(e, n)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := md5.Sum([]byte(value))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AddHMACKey registers a named secret for the hmac_sha256 expression. Secrets
+// are referenced by name so that they never appear in conditions.
+func (e *Evaluator) AddHMACKey(name string, secret []byte) {
+	if e.hmacKeys == nil {
+		e.hmacKeys = map[string][]byte{}
+	}
+	e.hmacKeys[name] = secret
+}
+
+// HmacSha256ExpressionHandler returns the hex encoded HMAC-SHA256 of a string.
+// It takes the string and the name of a key registered with AddHMACKey.
+func HmacSha256ExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	args := NewArgs(e, n)
+	value, err := args.String(0)
+	if err != nil {
+		return nil, err
+	}
+
+	keyName, err := args.String(1)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, ok := e.hmacKeys[keyName]
+	if !ok {
+		return nil, newError(ErrorKindValue, "unknown HMAC key %q", keyName)
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
@@ -0,0 +1,98 @@
+package condition
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEncoding(t *testing.T) {
+	evaluator := NewDefaultEvaluator()
+	evaluator.AddHMACKey("warehouse", []byte("key"))
+
+	ctx := map[string]interface{}{
+		"email": "user@example.com",
+		"ref":   "https://example.com:8443/landing/page?utm_source=news%20letter&id=1&id=2#top",
+	}
+
+	testCases := []struct {
+		in  string
+		out interface{}
+	}{
+		{in: `{"base64_encode": "hello world"}`, out: "aGVsbG8gd29ybGQ="},
+		{in: `{"base64_encode": ""}`, out: ""},
+		{in: `{"base64_decode": "aGVsbG8gd29ybGQ="}`, out: "hello world"},
+		{in: `{"base64_decode": "aGVsbG8gd29ybGQ"}`, out: "hello world"},
+		{in: `{"base64_decode": "Pz8_"}`, out: "???"},
+		{in: `{"base64_decode": "Pz8/"}`, out: "???"},
+		{in: `{"base64_decode": {"base64_encode": "žąsis"}}`, out: "žąsis"},
+		{in: `{"url_decode": "news%20letter+2%2F3"}`, out: "news letter 2/3"},
+		{in: `{"sha256": "abc"}`, out: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{in: `{"sha256": ""}`, out: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{in: `{"md5": "abc"}`, out: "900150983cd24fb0d6963f7d28e17f72"},
+		{in: `{"hmac_sha256": ["The quick brown fox jumps over the lazy dog", "warehouse"]}`, out: "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"},
+		{in: `{"get": [{"url_parse": {"context": ["ref"]}}, ["query", "utm_source"]]}`, out: "news letter"},
+		{in: `{"get": [{"url_parse": {"context": ["ref"]}}, ["query", "id"]]}`, out: "1"},
+		{in: `{"get": [{"url_parse": {"context": ["ref"]}}, ["host"]]}`, out: "example.com:8443"},
+		{in: `{"get": [{"url_parse": {"context": ["ref"]}}, ["hostname"]]}`, out: "example.com"},
+		{in: `{"get": [{"url_parse": {"context": ["ref"]}}, ["port"]]}`, out: "8443"},
+		{in: `{"get": [{"url_parse": {"context": ["ref"]}}, ["path"]]}`, out: "/landing/page"},
+		{in: `{"get": [{"url_parse": {"context": ["ref"]}}, ["fragment"]]}`, out: "top"},
+		{
+			in: `{"url_parse": "/relative?a=b"}`,
+			out: map[string]interface{}{
+				"scheme":   "",
+				"host":     "",
+				"hostname": "",
+				"port":     "",
+				"path":     "/relative",
+				"query":    map[string]interface{}{"a": "b"},
+				"fragment": "",
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		root, err := Parse(test.in)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test.in, err.Error())
+		} else {
+			res, err := evaluator.Evaluate(ctx, root)
+			if err != nil {
+				t.Errorf("%q got an error: %s", test.in, err.Error())
+			} else if !reflect.DeepEqual(res, test.out) {
+				t.Errorf("%q expected %v got %v", test.in, test.out, res)
+			}
+		}
+	}
+
+	errorCases := []string{
+		`{"base64_encode": 1}`,
+		`{"base64_encode": ["a", "b"]}`,
+		`{"base64_decode": "not base64!"}`,
+		`{"base64_decode": "//79"}`,
+		`{"url_decode": "%zz"}`,
+		`{"url_parse": "http://[::1"}`,
+		`{"sha256": null}`,
+		`{"md5": {"context": ["missing"]}}`,
+		`{"hmac_sha256": ["value"]}`,
+		`{"hmac_sha256": ["value", "unknown"]}`,
+		`{"hmac_sha256": [1, "warehouse"]}`,
+	}
+
+	for _, test := range errorCases {
+		root, err := Parse(test)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test, err.Error())
+		} else if _, err := evaluator.Evaluate(ctx, root); err == nil {
+			t.Errorf("%q expected an error", test)
+		}
+	}
+}
+
+func TestAddHMACKeyZeroEvaluator(t *testing.T) {
+	e := &Evaluator{}
+	e.AddHMACKey("warehouse", []byte("key"))
+	if string(e.hmacKeys["warehouse"]) != "key" {
+		t.Errorf("expected key to be registered")
+	}
+}
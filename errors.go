@@ -0,0 +1,68 @@
+package condition
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorKind classifies evaluation errors so that they can be handled
+// selectively, e.g. by the try expression.
+type ErrorKind string
+
+const (
+	// ErrorKindUnknown is reported for errors that do not carry a kind, e.g.
+	// errors returned by custom expression handlers.
+	ErrorKindUnknown ErrorKind = "unknown"
+	// ErrorKindArity is used when an expression receives a wrong number of
+	// arguments.
+	ErrorKindArity ErrorKind = "arity"
+	// ErrorKindType is used when an argument has an unexpected type.
+	ErrorKindType ErrorKind = "type"
+	// ErrorKindValue is used when an argument has the right type, but an
+	// invalid value.
+	ErrorKindValue ErrorKind = "value"
+	// ErrorKindMissing is used when a context path has no value in strict
+	// mode.
+	ErrorKindMissing ErrorKind = "missing"
+	// ErrorKindUndefined is used for references to unknown functions and
+	// variables.
+	ErrorKindUndefined ErrorKind = "undefined"
+	// ErrorKindResolver is used when a context resolver fails.
+	ErrorKindResolver ErrorKind = "resolver"
+	// ErrorKindToken is used for missing, malformed, expired or otherwise
+	// invalid tokens.
+	ErrorKindToken ErrorKind = "token"
+	// ErrorKindForbidden is used for context reads that are not allowed by
+	// the context policy.
+	ErrorKindForbidden ErrorKind = "forbidden"
+	// ErrorKindLimit is used when evaluation exceeds a resource limit, e.g.
+	// the number of function calls. try never catches it.
+	ErrorKindLimit ErrorKind = "limit"
+)
+
+// EvaluationError is an error with a kind returned by built-in expressions.
+type EvaluationError struct {
+	Kind    ErrorKind
+	Message string
+}
+
+func (e *EvaluationError) Error() string {
+	return e.Message
+}
+
+func newError(kind ErrorKind, format string, args ...interface{}) error {
+	return &EvaluationError{
+		Kind:    kind,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// ErrorKindOf returns the kind of an evaluation error or ErrorKindUnknown if
+// err does not wrap an EvaluationError.
+func ErrorKindOf(err error) ErrorKind {
+	var evalErr *EvaluationError
+	if errors.As(err, &evalErr) {
+		return evalErr.Kind
+	}
+	return ErrorKindUnknown
+}
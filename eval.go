@@ -2,29 +2,116 @@ package condition
 
 import (
 	"errors"
-	"fmt"
+	"time"
 )
 
 type ExpressionFunc func(*Evaluator, *Node) (interface{}, error)
 
 type Evaluator struct {
-	funcs   map[string]ExpressionFunc
-	context interface{}
+	// funcs holds handlers wrapped with interceptors, handlers holds them as
+	// they were added.
+	funcs     map[string]ExpressionFunc
+	handlers  map[string]ExpressionFunc
+	resolvers map[string]ContextResolver
+	macros    map[string]*macro
+	jwtKeys   map[string]*JWTKey
+	hmacKeys  map[string][]byte
+	context   interface{}
+
+	// resolved holds values returned by context resolvers during current
+	// evaluation.
+	resolved map[string]interface{}
+
+	// scope holds variables bound by let expressions that are visible to the
+	// node being evaluated.
+	scope *scope
+
+	// defaultOptions are used by Evaluate, options are used by current
+	// evaluation.
+	defaultOptions Options
+	options        Options
+
+	// trace holds entries recorded during current evaluation.
+	trace []TraceEntry
+
+	// clock returns current time. now is read from the clock once per
+	// evaluation so that all time based expressions see the same time.
+	clock func() time.Time
+	now   time.Time
+
+	// interceptors wrap every function call.
+	interceptors []Interceptor
+
+	// contextPolicy restricts context paths read by conditions.
+	contextPolicy *ContextPolicy
+
+	// partial is set during PartialEvaluate. unknown is set when an
+	// expression evaluated during partial evaluation uses an unknown value.
+	partial bool
+	unknown bool
 }
 
 func NewEvaluator() *Evaluator {
 	return &Evaluator{
-		funcs:   map[string]ExpressionFunc{},
-		context: nil,
+		funcs:     map[string]ExpressionFunc{},
+		handlers:  map[string]ExpressionFunc{},
+		resolvers: map[string]ContextResolver{},
+		macros:    map[string]*macro{},
+		jwtKeys:   map[string]*JWTKey{},
+		hmacKeys:  map[string][]byte{},
+		context:   nil,
 	}
 }
 
 func (e Evaluator) AddHandler(name string, handler ExpressionFunc) {
-	e.funcs[name] = newExpression(name, handler)
+	e.setHandler(name, newExpression(name, handler))
+}
+
+// SetClock sets the function used by time based expressions to get current
+// time. It defaults to time.Now.
+func (e *Evaluator) SetClock(clock func() time.Time) {
+	e.clock = clock
+}
+
+// currentTime returns the time of current evaluation.
+func (e *Evaluator) currentTime() time.Time {
+	if e.partial {
+		e.unknown = true
+	}
+
+	if e.now.IsZero() {
+		if e.clock != nil {
+			e.now = e.clock()
+		} else {
+			e.now = time.Now()
+		}
+	}
+	return e.now
+}
+
+// AddResolver registers a context resolver for a top level context key. The
+// resolver is used when the key is missing from the evaluation context.
+func (e *Evaluator) AddResolver(key string, resolver ContextResolver) {
+	if e.resolvers == nil {
+		e.resolvers = map[string]ContextResolver{}
+	}
+	e.resolvers[key] = resolver
 }
 
 func (e *Evaluator) Evaluate(ctx interface{}, root *Node) (interface{}, error) {
+	return e.EvaluateWithOptions(ctx, root, e.defaultOptions)
+}
+
+// EvaluateWithOptions evaluates root using the given options instead of the
+// ones set with SetOptions.
+func (e *Evaluator) EvaluateWithOptions(ctx interface{}, root *Node, options Options) (interface{}, error) {
 	e.context = ctx
+	e.options = options
+	e.resolved = nil
+	e.scope = nil
+	e.trace = nil
+	e.now = time.Time{}
+	e.partial = false
 	return e.evaluateNode(root)
 }
 
@@ -40,7 +127,7 @@ func (e *Evaluator) evaluateNode(n *Node) (interface{}, error) {
 		funcName := n.Token.Value.(string)
 		f, ok := e.funcs[funcName]
 		if !ok {
-			return nil, fmt.Errorf("no expression handler bound to %q", funcName)
+			return nil, newError(ErrorKindUndefined, "no expression handler bound to %q", funcName)
 		}
 		return f(e, n)
 	case NodeTypeArray:
@@ -1,19 +1,467 @@
 package condition
 
+// DefaultRegistry holds all built-in functions.
+var DefaultRegistry = NewRegistry()
+
+// ExpressionRegistry maps built-in function names to their handlers.
+//
+// Deprecated: use DefaultRegistry, which also carries function metadata.
+// ExpressionRegistry is a snapshot taken at package initialization and does
+// not include functions registered later.
 var ExpressionRegistry map[string]ExpressionFunc
 
+var (
+	anyArg       = ArgSpec{Name: "value", Type: TypeAny}
+	stringArg    = ArgSpec{Name: "value", Type: TypeString}
+	pathArg      = ArgSpec{Name: "path", Type: OneOf(TypeString, TypeArray)}
+	saltArg      = ArgSpec{Name: "salt", Type: OneOf(TypeString, TypeNull)}
+	pointArg     = ArgSpec{Name: "point", Type: OneOf(TypeArray, TypeObject)}
+	unitArg      = ArgSpec{Name: "unit", Type: TypeString}
+	timeZoneArg  = ArgSpec{Name: "time_zone", Type: OneOf(TypeString, TypeNull)}
+	objectArgDef = ArgSpec{Name: "object", Type: TypeObject}
+	keysArg      = ArgSpec{Name: "keys", Type: OneOf(TypeString, TypeArray)}
+)
+
+var builtinFunctions = map[string]FunctionSpec{
+	"and": {
+		Handler:     AndExpressionHandler,
+		MinArgs:     0,
+		MaxArgs:     Variadic,
+		Args:        []ArgSpec{{Name: "predicate", Type: TypeAny}},
+		Returns:     TypeBoolean,
+		Pure:        true,
+		Description: "Returns true if all arguments are true. Arguments are evaluated in order up to the first false one.",
+	},
+	"or": {
+		Handler:     OrExpressionHandler,
+		MinArgs:     0,
+		MaxArgs:     Variadic,
+		Args:        []ArgSpec{{Name: "predicate", Type: TypeAny}},
+		Returns:     TypeBoolean,
+		Pure:        true,
+		Description: "Returns true if any of the arguments is true. Arguments are evaluated in order up to the first true one.",
+	},
+	"not": {
+		Handler:     NotExpressionHandler,
+		MinArgs:     1,
+		MaxArgs:     1,
+		Args:        []ArgSpec{{Name: "predicate", Type: TypeAny}},
+		Returns:     TypeBoolean,
+		Pure:        true,
+		Description: "Negates its argument.",
+	},
+	"if": {
+		Handler: IfExpressionHandler,
+		MinArgs: 2,
+		MaxArgs: 3,
+		Args: []ArgSpec{
+			{Name: "predicate", Type: TypeAny},
+			{Name: "then", Type: TypeAny},
+			{Name: "else", Type: TypeAny},
+		},
+		Returns:     TypeAny,
+		Pure:        true,
+		Description: "Returns the second argument if the predicate is true and the optional third argument, or null, otherwise.",
+	},
+	"context": {
+		Handler:     ContextExpressionHandler,
+		MinArgs:     0,
+		MaxArgs:     Variadic,
+		Args:        []ArgSpec{{Name: "path", Type: OneOf(TypeString, TypeNumber)}},
+		Returns:     TypeAny,
+		Description: "Returns the context value at a path given as path elements, a JSON Pointer or a dotted path. Returns null if there is no value.",
+	},
+	"gt": {
+		Handler:     GtExpressionHandler,
+		MinArgs:     2,
+		MaxArgs:     2,
+		Args:        []ArgSpec{{Name: "a", Type: TypeNumber}, {Name: "b", Type: TypeNumber}},
+		Returns:     TypeBoolean,
+		Pure:        true,
+		Description: "Returns true if a > b.",
+	},
+	"lt": {
+		Handler:     LtExpressionHandler,
+		MinArgs:     2,
+		MaxArgs:     2,
+		Args:        []ArgSpec{{Name: "a", Type: TypeNumber}, {Name: "b", Type: TypeNumber}},
+		Returns:     TypeBoolean,
+		Pure:        true,
+		Description: "Returns true if a < b.",
+	},
+	"gte": {
+		Handler:     GteExpressionHandler,
+		MinArgs:     2,
+		MaxArgs:     2,
+		Args:        []ArgSpec{{Name: "a", Type: TypeNumber}, {Name: "b", Type: TypeNumber}},
+		Returns:     TypeBoolean,
+		Pure:        true,
+		Description: "Returns true if a >= b.",
+	},
+	"lte": {
+		Handler:     LteExpressionHandler,
+		MinArgs:     2,
+		MaxArgs:     2,
+		Args:        []ArgSpec{{Name: "a", Type: TypeNumber}, {Name: "b", Type: TypeNumber}},
+		Returns:     TypeBoolean,
+		Pure:        true,
+		Description: "Returns true if a <= b.",
+	},
+	"eq": {
+		Handler:     EqExpressionHandler,
+		MinArgs:     0,
+		MaxArgs:     Variadic,
+		Args:        []ArgSpec{{Name: "a", Type: TypeAny}, {Name: "b", Type: TypeAny}},
+		Returns:     TypeBoolean,
+		Pure:        true,
+		Description: "Returns true if two scalar values are equal and false if not passed exactly two arguments. Arrays and objects can't be compared and are a type error.",
+	},
+	"sha1mod": {
+		Handler:     Sha1modExpressionHandler,
+		MinArgs:     2,
+		MaxArgs:     3,
+		Args:        []ArgSpec{{Name: "key", Type: TypeAny}, {Name: "modulus", Type: TypeNumber}, saltArg},
+		Returns:     TypeNumber,
+		Pure:        true,
+		Description: "Hashes the key with SHA1 and returns the remainder of division by the modulus.",
+	},
+	"hashmod": {
+		Handler: HashmodExpressionHandler,
+		MinArgs: 3,
+		MaxArgs: 4,
+		Args: []ArgSpec{
+			{Name: "algorithm", Type: TypeString},
+			{Name: "key", Type: TypeAny},
+			{Name: "modulus", Type: TypeNumber},
+			saltArg,
+		},
+		Returns:     TypeNumber,
+		Pure:        true,
+		Description: "Hashes the key with sha1, murmur3, xxhash or fnv and returns the remainder of division by the modulus.",
+	},
+	"bucket": {
+		Handler:     BucketExpressionHandler,
+		MinArgs:     1,
+		MaxArgs:     3,
+		Args:        []ArgSpec{{Name: "key", Type: TypeAny}, saltArg, {Name: "algorithm", Type: TypeString}},
+		Returns:     TypeNumber,
+		Pure:        true,
+		Description: "Hashes the key and maps the hash to a number in the [0, 1) range.",
+	},
+	"variant": {
+		Handler:     VariantExpressionHandler,
+		MinArgs:     3,
+		MaxArgs:     3,
+		Args:        []ArgSpec{{Name: "key", Type: TypeAny}, saltArg, {Name: "variants", Type: TypeArray}},
+		Returns:     TypeAny,
+		Pure:        true,
+		Description: "Deterministically assigns the key to one of the weighted [name, weight] variants and returns its name.",
+	},
+	"let": {
+		Handler:     LetExpressionHandler,
+		MinArgs:     2,
+		MaxArgs:     Variadic,
+		Args:        []ArgSpec{{Name: "binding", Type: TypeObject}, {Name: "body", Type: TypeAny}},
+		Returns:     TypeAny,
+		Pure:        true,
+		Description: "Binds variables from {name: expression} arguments and returns the value of the last argument.",
+	},
+	"var": {
+		Handler:     VarExpressionHandler,
+		MinArgs:     1,
+		MaxArgs:     1,
+		Args:        []ArgSpec{{Name: "name", Type: TypeString}},
+		Returns:     TypeAny,
+		Description: "Returns the value of a variable bound by an enclosing let.",
+	},
+	"cond": {
+		Handler:     CondExpressionHandler,
+		MinArgs:     1,
+		MaxArgs:     Variadic,
+		Args:        []ArgSpec{{Name: "clause", Type: TypeAny}},
+		Returns:     TypeAny,
+		Pure:        true,
+		Description: "Returns the value of the first [predicate, value] pair with a true predicate or the last argument if none match.",
+	},
+	"switch": {
+		Handler:     SwitchExpressionHandler,
+		MinArgs:     2,
+		MaxArgs:     Variadic,
+		Args:        []ArgSpec{{Name: "value", Type: TypeAny}, {Name: "case", Type: TypeAny}},
+		Returns:     TypeAny,
+		Pure:        true,
+		Description: "Returns the value of the first [case, value] pair equal to the first argument or the last argument if none match.",
+	},
+	"exists": {
+		Handler:     ExistsExpressionHandler,
+		MinArgs:     0,
+		MaxArgs:     Variadic,
+		Args:        []ArgSpec{{Name: "path", Type: OneOf(TypeString, TypeNumber)}},
+		Returns:     TypeBoolean,
+		Description: "Returns true if there is a value, including null, at the context path.",
+	},
+	"is_null": {
+		Handler:     IsNullExpressionHandler,
+		MinArgs:     1,
+		MaxArgs:     1,
+		Args:        []ArgSpec{anyArg},
+		Returns:     TypeBoolean,
+		Pure:        true,
+		Description: "Returns true if its argument is null.",
+	},
+	"coalesce": {
+		Handler:     CoalesceExpressionHandler,
+		MinArgs:     0,
+		MaxArgs:     Variadic,
+		Args:        []ArgSpec{anyArg},
+		Returns:     TypeAny,
+		Pure:        true,
+		Description: "Returns the first argument that is not null.",
+	},
+	"default": {
+		Handler:     DefaultExpressionHandler,
+		MinArgs:     2,
+		MaxArgs:     2,
+		Args:        []ArgSpec{anyArg, {Name: "default", Type: TypeAny}},
+		Returns:     TypeAny,
+		Pure:        true,
+		Description: "Returns the first argument unless it is null, in which case the second argument is returned.",
+	},
+	"type_of": {
+		Handler:     TypeOfExpressionHandler,
+		MinArgs:     1,
+		MaxArgs:     1,
+		Args:        []ArgSpec{anyArg},
+		Returns:     TypeString,
+		Pure:        true,
+		Description: "Returns the JSON type name of its argument: null, boolean, number, string, array or object.",
+	},
+	"try": {
+		Handler: TryExpressionHandler,
+		MinArgs: 2,
+		MaxArgs: 3,
+		Args: []ArgSpec{
+			{Name: "expression", Type: TypeAny},
+			{Name: "fallback", Type: TypeAny},
+			{Name: "kinds", Type: OneOf(TypeString, TypeArray)},
+		},
+		Returns:     TypeAny,
+		Description: "Returns the value of the first argument or, if it fails with one of the error kinds, the value of the second argument.",
+	},
+	"get": {
+		Handler:     GetExpressionHandler,
+		MinArgs:     2,
+		MaxArgs:     2,
+		Args:        []ArgSpec{anyArg, pathArg},
+		Returns:     TypeAny,
+		Pure:        true,
+		Description: "Returns the value at a path in its first argument or null if there is no value.",
+	},
+	"object": {
+		Handler:     ObjectExpressionHandler,
+		MinArgs:     0,
+		MaxArgs:     Variadic,
+		Args:        []ArgSpec{{Name: "pair", Type: TypeArray}},
+		Returns:     TypeObject,
+		Pure:        true,
+		Description: "Builds an object from [key, value] pairs.",
+	},
+	"keys": {
+		Handler:     KeysExpressionHandler,
+		MinArgs:     1,
+		MaxArgs:     1,
+		Args:        []ArgSpec{objectArgDef},
+		Returns:     TypeArray,
+		Pure:        true,
+		Description: "Returns sorted keys of an object.",
+	},
+	"values": {
+		Handler:     ValuesExpressionHandler,
+		MinArgs:     1,
+		MaxArgs:     1,
+		Args:        []ArgSpec{objectArgDef},
+		Returns:     TypeArray,
+		Pure:        true,
+		Description: "Returns values of an object ordered by key.",
+	},
+	"entries": {
+		Handler:     EntriesExpressionHandler,
+		MinArgs:     1,
+		MaxArgs:     1,
+		Args:        []ArgSpec{objectArgDef},
+		Returns:     TypeArray,
+		Pure:        true,
+		Description: "Returns [key, value] pairs of an object ordered by key.",
+	},
+	"has_key": {
+		Handler:     HasKeyExpressionHandler,
+		MinArgs:     2,
+		MaxArgs:     2,
+		Args:        []ArgSpec{objectArgDef, {Name: "key", Type: TypeString}},
+		Returns:     TypeBoolean,
+		Pure:        true,
+		Description: "Returns true if the object has the key.",
+	},
+	"merge": {
+		Handler:     MergeExpressionHandler,
+		MinArgs:     0,
+		MaxArgs:     Variadic,
+		Args:        []ArgSpec{{Name: "object", Type: OneOf(TypeObject, TypeNull)}},
+		Returns:     TypeObject,
+		Pure:        true,
+		Description: "Returns a shallow merge of its arguments. Keys of later objects override keys of earlier ones.",
+	},
+	"pick": {
+		Handler:     PickExpressionHandler,
+		MinArgs:     2,
+		MaxArgs:     2,
+		Args:        []ArgSpec{objectArgDef, keysArg},
+		Returns:     TypeObject,
+		Pure:        true,
+		Description: "Returns a copy of an object with only the given keys.",
+	},
+	"omit": {
+		Handler:     OmitExpressionHandler,
+		MinArgs:     2,
+		MaxArgs:     2,
+		Args:        []ArgSpec{objectArgDef, keysArg},
+		Returns:     TypeObject,
+		Pure:        true,
+		Description: "Returns a copy of an object without the given keys.",
+	},
+	"in_schedule": {
+		Handler: InScheduleExpressionHandler,
+		MinArgs: 2,
+		MaxArgs: 3,
+		Args: []ArgSpec{
+			{Name: "cron", Type: TypeString},
+			{Name: "duration", Type: TypeString},
+			timeZoneArg,
+		},
+		Returns:     TypeBoolean,
+		Description: "Returns true if the current time is within a duration after a time matching a cron expression.",
+	},
+	"in_window": {
+		Handler: InWindowExpressionHandler,
+		MinArgs: 3,
+		MaxArgs: 4,
+		Args: []ArgSpec{
+			{Name: "days", Type: OneOf(TypeString, TypeArray)},
+			{Name: "start", Type: TypeString},
+			{Name: "end", Type: TypeString},
+			timeZoneArg,
+		},
+		Returns:     TypeBoolean,
+		Description: "Returns true if the current time is within a weekly recurring window.",
+	},
+	"geo_distance": {
+		Handler:     GeoDistanceExpressionHandler,
+		MinArgs:     2,
+		MaxArgs:     3,
+		Args:        []ArgSpec{pointArg, {Name: "other", Type: pointArg.Type}, unitArg},
+		Returns:     TypeNumber,
+		Pure:        true,
+		Description: "Returns the great circle distance between two points in km or mi.",
+	},
+	"geo_within_radius": {
+		Handler: GeoWithinRadiusExpressionHandler,
+		MinArgs: 3,
+		MaxArgs: 4,
+		Args: []ArgSpec{
+			pointArg,
+			{Name: "center", Type: pointArg.Type},
+			{Name: "radius", Type: TypeNumber},
+			unitArg,
+		},
+		Returns:     TypeBoolean,
+		Pure:        true,
+		Description: "Returns true if a point is at most radius away from the center.",
+	},
+	"geo_in_polygon": {
+		Handler:     GeoInPolygonExpressionHandler,
+		MinArgs:     2,
+		MaxArgs:     2,
+		Args:        []ArgSpec{pointArg, {Name: "polygon", Type: OneOf(TypeArray, TypeObject)}},
+		Returns:     TypeBoolean,
+		Pure:        true,
+		Description: "Returns true if a point is inside a GeoJSON Polygon or MultiPolygon.",
+	},
+	"jwt_claims": {
+		Handler:     JWTClaimsExpressionHandler,
+		MinArgs:     1,
+		MaxArgs:     2,
+		Args:        []ArgSpec{{Name: "token", Type: OneOf(TypeString, TypeNull)}, {Name: "key", Type: TypeString}},
+		Returns:     TypeObject,
+		Description: "Verifies a JSON Web Token with a configured key and returns its claims.",
+	},
+	"base64_encode": {
+		Handler:     Base64EncodeExpressionHandler,
+		MinArgs:     1,
+		MaxArgs:     1,
+		Args:        []ArgSpec{stringArg},
+		Returns:     TypeString,
+		Pure:        true,
+		Description: "Returns the standard, padded base64 encoding of a string.",
+	},
+	"base64_decode": {
+		Handler:     Base64DecodeExpressionHandler,
+		MinArgs:     1,
+		MaxArgs:     1,
+		Args:        []ArgSpec{stringArg},
+		Returns:     TypeString,
+		Pure:        true,
+		Description: "Decodes a standard or URL safe base64 string.",
+	},
+	"url_decode": {
+		Handler:     URLDecodeExpressionHandler,
+		MinArgs:     1,
+		MaxArgs:     1,
+		Args:        []ArgSpec{stringArg},
+		Returns:     TypeString,
+		Pure:        true,
+		Description: "Decodes a percent encoded string.",
+	},
+	"url_parse": {
+		Handler:     URLParseExpressionHandler,
+		MinArgs:     1,
+		MaxArgs:     1,
+		Args:        []ArgSpec{stringArg},
+		Returns:     TypeObject,
+		Pure:        true,
+		Description: "Parses a URL into an object with scheme, host, hostname, port, path, query and fragment keys.",
+	},
+	"sha256": {
+		Handler:     Sha256ExpressionHandler,
+		MinArgs:     1,
+		MaxArgs:     1,
+		Args:        []ArgSpec{stringArg},
+		Returns:     TypeString,
+		Pure:        true,
+		Description: "Returns the hex encoded SHA-256 digest of a string.",
+	},
+	"md5": {
+		Handler:     Md5ExpressionHandler,
+		MinArgs:     1,
+		MaxArgs:     1,
+		Args:        []ArgSpec{stringArg},
+		Returns:     TypeString,
+		Pure:        true,
+		Description: "Returns the hex encoded MD5 digest of a string.",
+	},
+	"hmac_sha256": {
+		Handler:     HmacSha256ExpressionHandler,
+		MinArgs:     2,
+		MaxArgs:     2,
+		Args:        []ArgSpec{stringArg, {Name: "key", Type: TypeString}},
+		Returns:     TypeString,
+		Description: "Returns the hex encoded HMAC-SHA256 of a string using a configured key.",
+	},
+}
+
 func init() {
-	ExpressionRegistry = map[string]ExpressionFunc{
-		"and":     AndExpressionHandler,
-		"or":      OrExpressionHandler,
-		"not":     NotExpressionHandler,
-		"if":      IfExpressionHandler,
-		"context": ContextExpressionHandler,
-		"gt":      GtExpressionHandler,
-		"lt":      LtExpressionHandler,
-		"gte":     GteExpressionHandler,
-		"lte":     LteExpressionHandler,
-		"eq":      EqExpressionHandler,
-		"sha1mod": Sha1modExpressionHandler,
+	ExpressionRegistry = map[string]ExpressionFunc{}
+	for name, spec := range builtinFunctions {
+		DefaultRegistry.MustRegister(name, spec)
+		ExpressionRegistry[name] = spec.checkedHandler()
 	}
 }
@@ -1,10 +1,11 @@
 package condition
 
 import (
-	"crypto/sha1"
-	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -18,16 +19,30 @@ func newExpression(name string, handler ExpressionFunc) ExpressionFunc {
 	return func(e *Evaluator, n *Node) (interface{}, error) {
 		res, err := handler(e, n)
 		if err != nil {
-			return nil, fmt.Errorf("%s expression: %s", name, err.Error())
+			return nil, fmt.Errorf("%s expression: %w", name, err)
 		}
 		return res, nil
 	}
 }
 
+// functionArgs returns argument nodes of a function node. Arguments are either
+// passed in as an array or as a single value.
+func functionArgs(n *Node) []*Node {
+	if len(n.Children) == 0 {
+		return nil
+	}
+
+	if n.Children[0].Type == NodeTypeArray {
+		return n.Children[0].Children
+	}
+
+	return n.Children[:1]
+}
+
 func OrExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
 	child := n.Children[0]
 	if child.Type != NodeTypeArray {
-		return nil, fmt.Errorf(errExpectedArrayInput, child.Type)
+		return nil, newError(ErrorKindType, errExpectedArrayInput, child.Type)
 	}
 
 	for _, n := range child.Children {
@@ -36,7 +51,10 @@ func OrExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
 			return nil, err
 		}
 
-		asBool := castToBool(res)
+		asBool, err := e.predicate(res)
+		if err != nil {
+			return nil, err
+		}
 		if asBool == true {
 			return true, nil
 		}
@@ -49,7 +67,7 @@ func OrExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
 func AndExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
 	child := n.Children[0]
 	if child.Type != NodeTypeArray {
-		return nil, fmt.Errorf(errExpectedArrayInput, child.Type)
+		return nil, newError(ErrorKindType, errExpectedArrayInput, child.Type)
 	}
 
 	for _, n := range child.Children {
@@ -58,7 +76,10 @@ func AndExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
 			return nil, err
 		}
 
-		asBool := castToBool(res)
+		asBool, err := e.predicate(res)
+		if err != nil {
+			return nil, err
+		}
 		if asBool == false {
 			return false, nil
 		}
@@ -68,217 +89,637 @@ func AndExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
 	return true, nil
 }
 
+// EqExpressionHandler returns true if its two arguments are equal. Arrays and
+// objects can't be compared and are a type error.
 func EqExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
-	if len(n.Children) != 1 && n.Children[0].Type != NodeTypeArray {
-		return false, nil
-	}
-
-	params := n.Children[0]
-	if len(params.Children) != 2 {
+	args := NewArgs(e, n)
+	if args.Len() != 2 {
 		return false, nil
 	}
 
-	resA, err := e.evaluateNode(params.Children[0])
+	resA, err := args.Value(0)
 	if err != nil {
 		return nil, err
 	}
 
-	resB, err := e.evaluateNode(params.Children[1])
+	resB, err := args.Value(1)
 	if err != nil {
 		return nil, err
 	}
 
+	if !isScalar(resA) || !isScalar(resB) {
+		return nil, newError(ErrorKindType, "expected scalar values, got %s and %s", typeOf(resA), typeOf(resB))
+	}
+
 	return resA == resB, nil
 }
 
+// isScalar returns true if v is null, a boolean, a number or a string.
+func isScalar(v interface{}) bool {
+	switch v.(type) {
+	case []interface{}, map[string]interface{}:
+		return false
+	}
+
+	return true
+}
+
 func NotExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
 	if len(n.Children) != 1 {
-		return nil, fmt.Errorf(errExpectedNArguments, 1, len(n.Children))
+		return nil, newError(ErrorKindArity, errExpectedNArguments, 1, len(n.Children))
 	}
 	res, err := e.evaluateNode(n.Children[0])
 	if err != nil {
 		return nil, err
 	}
 
-	return !castToBool(res), nil
-}
-
-func GtExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
-	params := n.Children[0]
-
-	if len(params.Children) != 2 {
-		return nil, fmt.Errorf(errExpectedNArguments, 2, len(params.Children))
+	asBool, err := e.predicate(res)
+	if err != nil {
+		return nil, err
 	}
 
-	resA, err := e.evaluateNode(params.Children[0])
+	return !asBool, nil
+}
+
+// compareNumbers evaluates two number arguments and compares them with cmp.
+func compareNumbers(args *Args, cmp func(a, b float64) bool) (interface{}, error) {
+	resA, err := args.Value(0)
 	if err != nil {
 		return nil, err
 	}
 
-	resB, err := e.evaluateNode(params.Children[1])
+	resB, err := args.Value(1)
 	if err != nil {
 		return nil, err
 	}
 
 	floatA, ok := resA.(float64)
 	if !ok {
-		return nil, fmt.Errorf(errExpectedNumber)
+		return nil, newError(ErrorKindType, errExpectedNumber)
 	}
 
 	floatB, ok := resB.(float64)
 	if !ok {
-		return nil, fmt.Errorf(errExpectedNumber)
+		return nil, newError(ErrorKindType, errExpectedNumber)
 	}
 
-	return floatA > floatB, nil
+	return cmp(floatA, floatB), nil
+}
+
+func GtExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	return compareNumbers(NewArgs(e, n), func(a, b float64) bool { return a > b })
 }
 
 func GteExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
-	params := n.Children[0]
+	return compareNumbers(NewArgs(e, n), func(a, b float64) bool { return a >= b })
+}
+
+func LtExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	return compareNumbers(NewArgs(e, n), func(a, b float64) bool { return a < b })
+}
+
+func LteExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	return compareNumbers(NewArgs(e, n), func(a, b float64) bool { return a <= b })
+}
 
-	if len(params.Children) != 2 {
-		return nil, fmt.Errorf(errExpectedNArguments, 2, len(params.Children))
+func IfExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	if n.Children[0].Type != NodeTypeArray {
+		return nil, newError(ErrorKindType, errExpectedArrayInput, n.Children[0].Type)
 	}
 
-	resA, err := e.evaluateNode(params.Children[0])
+	args := NewArgs(e, n)
+	resAsBool, err := args.Predicate(0)
 	if err != nil {
 		return nil, err
 	}
 
-	resB, err := e.evaluateNode(params.Children[1])
+	if resAsBool {
+		return args.Value(1)
+	} else if args.Has(2) {
+		return args.Value(2)
+	}
+
+	return nil, nil
+}
+
+// CondExpressionHandler evaluates [predicate, value] pairs in order and returns
+// the value of the first pair whose predicate evaluates to true. The last
+// argument is the default value returned when no predicate matches. Only the
+// predicates up to the first match and the returned value are evaluated.
+func CondExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	args := NewArgs(e, n)
+	if err := args.Expect(1, Variadic); err != nil {
+		return nil, err
+	}
+
+	last := args.Len() - 1
+	for i := 0; i < last; i++ {
+		pair := args.Node(i)
+		if pair.Type != NodeTypeArray || len(pair.Children) != 2 {
+			return nil, newError(ErrorKindType, "expected [predicate, value] pair, got %s", getNodeName(pair))
+		}
+
+		predicateRes, err := e.evaluateNode(pair.Children[0])
+		if err != nil {
+			return nil, err
+		}
+
+		resAsBool, err := e.predicate(predicateRes)
+		if err != nil {
+			return nil, err
+		}
+
+		if resAsBool {
+			return e.evaluateNode(pair.Children[1])
+		}
+	}
+
+	return args.Value(last)
+}
+
+// SwitchExpressionHandler compares its first argument against [case, value]
+// pairs using deep equality and returns the value of the first matching case.
+// The last argument is the default value returned when no case matches. Cases
+// are evaluated in order up to the first match.
+func SwitchExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	args := NewArgs(e, n)
+	if err := args.Expect(2, Variadic); err != nil {
+		return nil, err
+	}
+
+	value, err := args.Value(0)
 	if err != nil {
 		return nil, err
 	}
 
-	floatA, ok := resA.(float64)
-	if !ok {
-		return nil, fmt.Errorf(errExpectedNumber)
+	last := args.Len() - 1
+	for i := 1; i < last; i++ {
+		pair := args.Node(i)
+		if pair.Type != NodeTypeArray || len(pair.Children) != 2 {
+			return nil, newError(ErrorKindType, "expected [case, value] pair, got %s", getNodeName(pair))
+		}
+
+		caseRes, err := e.evaluateNode(pair.Children[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if reflect.DeepEqual(value, caseRes) {
+			return e.evaluateNode(pair.Children[1])
+		}
 	}
 
-	floatB, ok := resB.(float64)
+	return args.Value(last)
+}
+
+// TryExpressionHandler returns the result of its first argument or, if that
+// fails, the result of its second argument. An optional third argument is an
+// error kind or a list of error kinds to catch, other errors are returned as
+// is. Caught errors are recorded in the evaluation trace.
+func TryExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	args := NewArgs(e, n)
+	res, tryErr := args.Value(0)
+	if tryErr == nil {
+		return res, nil
+	}
+
+	kind := ErrorKindOf(tryErr)
+	if kind == ErrorKindLimit {
+		return nil, tryErr
+	}
+
+	if args.Has(2) {
+		kinds, err := args.Value(2)
+		if err != nil {
+			return nil, err
+		}
+
+		caught, err := matchesErrorKind(kind, kinds)
+		if err != nil {
+			return nil, err
+		}
+
+		if !caught {
+			return nil, tryErr
+		}
+	}
+
+	e.addTrace(TraceEntry{
+		Expression: n.Token.Value.(string),
+		Kind:       kind,
+		Message:    tryErr.Error(),
+	})
+
+	return args.Value(1)
+}
+
+// matchesErrorKind checks if kind is listed in kinds, which is either a string
+// or an array of strings.
+func matchesErrorKind(kind ErrorKind, kinds interface{}) (bool, error) {
+	switch v := kinds.(type) {
+	case string:
+		return ErrorKind(v) == kind, nil
+	case []interface{}:
+		for _, k := range v {
+			asString, ok := k.(string)
+			if !ok {
+				return false, newError(ErrorKindType, "expected error kind as a string")
+			}
+			if ErrorKind(asString) == kind {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	return false, newError(ErrorKindType, "expected error kind or a list of error kinds")
+}
+
+// Sha1modExpressionHandler hashes the first argument with SHA1 and returns the
+// remainder of division by the second argument. An optional third argument
+// salts the hashed value.
+func Sha1modExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	return hashmod(NewArgs(e, n), "sha1", 0)
+}
+
+// HashmodExpressionHandler works like sha1mod, but takes the name of the hash
+// algorithm as the first argument.
+func HashmodExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	args := NewArgs(e, n)
+	algorithm, err := args.Value(0)
+	if err != nil {
+		return nil, err
+	}
+
+	algorithmName, ok := algorithm.(string)
 	if !ok {
-		return nil, fmt.Errorf(errExpectedNumber)
+		return nil, newError(ErrorKindType, "expected hash algorithm name as a string")
 	}
 
-	return floatA >= floatB, nil
+	return hashmod(args, algorithmName, 1)
 }
 
-func LtExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
-	params := n.Children[0]
+// hashmod evaluates key, modulus and optional salt arguments starting at index
+// i and returns the remainder of key hash division by modulus.
+func hashmod(args *Args, algorithm string, i int) (interface{}, error) {
+	key, err := args.Value(i)
+	if err != nil {
+		return nil, err
+	}
 
-	if len(params.Children) != 2 {
-		return nil, fmt.Errorf(errExpectedNArguments, 2, len(params.Children))
+	mod, err := args.Value(i + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	modFloat, ok := mod.(float64)
+	if !ok || modFloat < 1 {
+		return nil, newError(ErrorKindValue, "expected positive number as a modulus")
+	}
+
+	salt := ""
+	if args.Has(i + 2) {
+		if salt, err = evaluateSalt(args, i+2); err != nil {
+			return nil, err
+		}
 	}
 
-	resA, err := e.evaluateNode(params.Children[0])
+	value, _, err := hashKey(algorithm, key, salt)
 	if err != nil {
 		return nil, err
 	}
 
-	resB, err := e.evaluateNode(params.Children[1])
+	return float64(value % uint64(modFloat)), nil
+}
+
+// BucketExpressionHandler hashes the first argument and maps the hash to a
+// number in the [0, 1) range. Optional second and third arguments are a salt
+// and hash algorithm name, which defaults to sha1.
+func BucketExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	args := NewArgs(e, n)
+	key, err := args.Value(0)
 	if err != nil {
 		return nil, err
 	}
 
-	floatA, ok := resA.(float64)
-	if !ok {
-		return nil, fmt.Errorf(errExpectedNumber)
+	salt := ""
+	if args.Has(1) {
+		if salt, err = evaluateSalt(args, 1); err != nil {
+			return nil, err
+		}
 	}
 
-	floatB, ok := resB.(float64)
-	if !ok {
-		return nil, fmt.Errorf(errExpectedNumber)
+	algorithm := "sha1"
+	if args.Has(2) {
+		res, err := args.Value(2)
+		if err != nil {
+			return nil, err
+		}
+
+		var ok bool
+		if algorithm, ok = res.(string); !ok {
+			return nil, newError(ErrorKindType, "expected hash algorithm name as a string")
+		}
 	}
 
-	return floatA < floatB, nil
+	value, alg, err := hashKey(algorithm, key, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	// float64 has 53 bits of precision, drop the rest so that the result
+	// never rounds up to 1. Low bits are kept because high bits of FNV-1a
+	// are poorly distributed for short keys.
+	if alg.size > 53 {
+		return float64(value&(1<<53-1)) / (1 << 53), nil
+	}
+
+	return float64(value) / float64(uint64(1)<<alg.size), nil
 }
 
-func LteExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
-	params := n.Children[0]
+// evaluateSalt evaluates the salt argument at index i, which must be a string
+// or null.
+func evaluateSalt(args *Args, i int) (string, error) {
+	res, err := args.Value(i)
+	if err != nil {
+		return "", err
+	}
 
-	if len(params.Children) != 2 {
-		return nil, fmt.Errorf(errExpectedNArguments, 2, len(params.Children))
+	switch v := res.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
 	}
 
-	resA, err := e.evaluateNode(params.Children[0])
+	return "", newError(ErrorKindType, "expected string or null as a salt")
+}
+
+// VariantExpressionHandler deterministically assigns a bucketing key to one of
+// the weighted variants. It takes a key, a salt and a list of [name, weight]
+// pairs. Weights must be non-negative integers. The key is hashed the same
+// way as in sha1mod and the remainder of division by the total weight picks
+// the variant, so with a null salt the assignment matches sha1mod bucketing.
+func VariantExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	args := NewArgs(e, n)
+	key, err := args.Value(0)
 	if err != nil {
 		return nil, err
 	}
 
-	resB, err := e.evaluateNode(params.Children[1])
+	salt, err := evaluateSalt(args, 1)
 	if err != nil {
 		return nil, err
 	}
 
-	floatA, ok := resA.(float64)
+	variantsValue, err := args.Value(2)
+	if err != nil {
+		return nil, err
+	}
+
+	variants, ok := variantsValue.([]interface{})
 	if !ok {
-		return nil, fmt.Errorf(errExpectedNumber)
+		return nil, newError(ErrorKindType, "expected a list of [name, weight] pairs")
 	}
 
-	floatB, ok := resB.(float64)
+	names := make([]interface{}, len(variants))
+	weights := make([]uint64, len(variants))
+	total := uint64(0)
+	for i, v := range variants {
+		pair, ok := v.([]interface{})
+		if !ok || len(pair) != 2 {
+			return nil, newError(ErrorKindType, "expected a list of [name, weight] pairs")
+		}
+
+		weight, ok := pair[1].(float64)
+		if !ok || weight < 0 || weight != float64(uint64(weight)) {
+			return nil, newError(ErrorKindValue, "variant weight must be a non-negative integer")
+		}
+
+		names[i] = pair[0]
+		weights[i] = uint64(weight)
+		total += weights[i]
+	}
+
+	if total == 0 {
+		return nil, newError(ErrorKindValue, "total variant weight must be greater than 0")
+	}
+
+	value, _, err := hashKey("sha1", key, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket := value % total
+	for i, weight := range weights {
+		if bucket < weight {
+			return names[i], nil
+		}
+		bucket -= weight
+	}
+
+	return nil, nil
+}
+
+// LetExpressionHandler binds variables for the duration of its last argument.
+// All arguments but the last must be single key objects mapping a variable
+// name to an expression. Bindings are visible to the body and to the bindings
+// that follow them and may shadow variables bound by outer let expressions.
+func LetExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	args := NewArgs(e, n)
+	if err := args.Expect(2, Variadic); err != nil {
+		return nil, err
+	}
+
+	outer := e.scope
+	current := outer
+	names := map[string]bool{}
+
+	last := args.Len() - 1
+	for i := 0; i < last; i++ {
+		param := args.Node(i)
+		if param.Type != NodeTypeFunction || len(param.Children) != 1 {
+			return nil, newError(ErrorKindType, "expected variable binding object, got %s", getNodeName(param))
+		}
+
+		name := param.Token.Value.(string)
+		if names[name] {
+			return nil, newError(ErrorKindValue, "variable %q is bound more than once", name)
+		}
+		names[name] = true
+
+		current = &scope{
+			parent: current,
+			name:   name,
+			binding: &binding{
+				node:  param.Children[0],
+				scope: current,
+			},
+		}
+	}
+
+	e.scope = current
+	res, err := args.Value(last)
+	e.scope = outer
+
+	return res, err
+}
+
+// VarExpressionHandler returns the value of a variable bound by an enclosing
+// let expression.
+func VarExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	param, err := NewArgs(e, n).node(0)
+	if err != nil {
+		return nil, err
+	}
+
+	name, ok := param.Token.Value.(string)
+	if param.Type != NodeTypeLiteral || !ok {
+		return nil, newError(ErrorKindType, "expected variable name as a string literal")
+	}
+
+	b, ok := e.scope.lookup(name)
 	if !ok {
-		return nil, fmt.Errorf(errExpectedNumber)
+		// The variable may be bound by an enclosing let that was not
+		// evaluated as a whole.
+		if e.partial {
+			e.unknown = true
+		}
+		return nil, newError(ErrorKindUndefined, "undefined variable %q", name)
 	}
 
-	return floatA <= floatB, nil
+	return e.evaluateBinding(b)
 }
 
-func IfExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
-	if n.Children[0].Type != NodeTypeArray {
-		return nil, fmt.Errorf(errExpectedArrayInput, n.Children[0].Type)
+func ContextExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	path, err := evaluateContextPath(e, n)
+	if err != nil {
+		return nil, err
 	}
 
-	params := n.Children[0].Children
-	if len(params) < 2 {
-		return nil, fmt.Errorf(errExpectedNArguments, 2, len(params))
-	} else if len(params) > 3 {
-		return nil, fmt.Errorf(errExpectedNArguments, 3, len(params))
+	if err := e.checkContextPath(path); err != nil {
+		return nil, err
 	}
 
-	predicateRes, err := e.evaluateNode(params[0])
+	val, err := e.ContextValue(path)
 	if err != nil {
 		return nil, err
 	}
 
-	resAsBool := castToBool(predicateRes)
-	if resAsBool {
-		return e.evaluateNode(params[1])
-	} else if len(params) > 2 {
-		return e.evaluateNode(params[2])
+	if _, ok := val.(NotFound); ok {
+		if e.options.Strict {
+			return nil, newError(ErrorKindMissing, "no value at context path %v", path)
+		}
+		return nil, nil
 	}
 
-	return nil, nil
+	return val, nil
 }
 
-func Sha1modExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
-	resA, err := e.evaluateNode(n.Children[0].Children[0])
+// ExistsExpressionHandler returns true if there is a value, including null, at
+// the context path passed in as arguments.
+func ExistsExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	path, err := evaluateContextPath(e, n)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := e.checkContextPath(path); err != nil {
+		return nil, err
+	}
+
+	val, err := e.ContextValue(path)
 	if err != nil {
 		return nil, err
 	}
-	resB, err := e.evaluateNode(n.Children[0].Children[1])
+
+	_, missing := val.(NotFound)
+	return !missing, nil
+}
+
+// IsNullExpressionHandler returns true if its argument evaluates to null.
+func IsNullExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	args := NewArgs(e, n)
+	res, err := args.Value(0)
 	if err != nil {
 		return nil, err
 	}
 
-	resBuint := uint64(resB.(float64))
+	return res == nil, nil
+}
+
+// CoalesceExpressionHandler returns the first argument that does not evaluate
+// to null. Arguments are evaluated in order up to the first non-null value.
+func CoalesceExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	args := NewArgs(e, n)
+	for i := 0; i < args.Len(); i++ {
+		res, err := args.Value(i)
+		if err != nil {
+			return nil, err
+		}
+
+		if res != nil {
+			return res, nil
+		}
+	}
+
+	return nil, nil
+}
 
-	keyValue, err := json.Marshal(resA)
+// DefaultExpressionHandler returns its first argument unless it evaluates to
+// null, in which case the second argument is evaluated and returned.
+func DefaultExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	args := NewArgs(e, n)
+	res, err := args.Value(0)
+	if err != nil || res != nil {
+		return res, err
+	}
+
+	return args.Value(1)
+}
+
+// TypeOfExpressionHandler returns the JSON type name of its argument: null,
+// boolean, number, string, array or object.
+func TypeOfExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	args := NewArgs(e, n)
+	res, err := args.Value(0)
 	if err != nil {
 		return nil, err
 	}
 
-	hash := sha1.Sum(keyValue)
-	value := binary.BigEndian.Uint64(hash[:8])
+	return typeOf(res), nil
+}
 
-	result := value % resBuint
-	return float64(result), nil
+func typeOf(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
 }
 
-func ContextExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+// evaluateContextPath evaluates path arguments of a context path expression.
+// The path is either an array of path elements or a single string holding a
+// JSON Pointer or a dotted path.
+func evaluateContextPath(e *Evaluator, n *Node) ([]interface{}, error) {
 	params := n.Children[0]
 
 	if params.Type != NodeTypeArray {
-		return nil, fmt.Errorf(errExpectedArrayInput, params.Type)
+		res, err := e.evaluateNode(params)
+		if err != nil {
+			return nil, err
+		}
+		return toPath(res)
 	}
 
 	evaluatedPath := []interface{}{}
@@ -290,6 +731,66 @@ func ContextExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
 		evaluatedPath = append(evaluatedPath, res)
 	}
 
+	return evaluatedPath, nil
+}
+
+// toPath converts an evaluated path argument, either an array of path elements
+// or a path string, to a list of path elements.
+func toPath(v interface{}) ([]interface{}, error) {
+	switch path := v.(type) {
+	case []interface{}:
+		return path, nil
+	case string:
+		return parsePathString(path)
+	}
+
+	return nil, newError(ErrorKindType, "expected path as an array or a string, got %s", typeOf(v))
+}
+
+// GetExpressionHandler returns the value at a path in its first argument. The
+// path is passed in as the second argument, either as an array of path
+// elements or as a JSON Pointer or dotted path string.
+func GetExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	args := NewArgs(e, n)
+	data, err := args.Value(0)
+	if err != nil {
+		return nil, err
+	}
+
+	pathValue, err := args.Value(1)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := toPath(pathValue)
+	if err != nil {
+		return nil, err
+	}
+
+	val, err := e.getPath(data, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := val.(NotFound); ok {
+		if e.options.Strict {
+			return nil, newError(ErrorKindMissing, "no value at path %v", path)
+		}
+		return nil, nil
+	}
+
+	return val, nil
+}
+
+// ContextValue returns the value at path in the evaluation context. Context
+// resolvers are consulted for top level keys missing from the context. If
+// there is no value at path, NotFound{} is returned, which lets expressions
+// tell missing values apart from explicit nulls.
+func (e *Evaluator) ContextValue(path []interface{}) (interface{}, error) {
+	if e.partial {
+		return e.knownContextValue(path)
+	}
+
 	ctx := ""
 	var decodedData interface{}
 
@@ -308,65 +809,116 @@ func ContextExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
 		}
 	}
 
-	val := recursiveGet(decodedData, evaluatedPath)
-	switch val.(type) {
+	if len(path) > 0 {
+		if key, ok := pathKey(path[0]); ok && key != wildcard && !hasKey(decodedData, key) {
+			resolvedData, ok, err := e.resolveContextKey(decodedData, key)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				if resolvedData == nil {
+					return NotFound{}, nil
+				}
+				decodedData = resolvedData
+				path = path[1:]
+			}
+		}
+	}
+
+	return e.getPath(decodedData, path)
+}
+
+// getPath returns the value at path in data or NotFound{} if there is none.
+// Values matched by wildcards are returned as an array.
+func (e *Evaluator) getPath(data interface{}, path []interface{}) (interface{}, error) {
+	if e.options.Strict {
+		for _, element := range path {
+			if index, ok := element.(float64); ok && index != float64(int(index)) {
+				return nil, newError(ErrorKindValue, "array index must be an integer, got %v", index)
+			}
+		}
+	}
+
+	val := recursiveGet(data, path)
+	switch v := val.(type) {
 	case pathTypeMismatch:
-		return nil, fmt.Errorf("only strings and integers supported as input values")
+		return nil, newError(ErrorKindType, "only strings and integers supported as input values")
 	case unknownPathType:
-		return nil, fmt.Errorf("only strings and integers supported as input values")
-	case notFound:
-		return nil, nil
+		return nil, newError(ErrorKindType, "only strings and integers supported as input values")
+	case wildcardMatches:
+		return []interface{}(v), nil
 	}
 
 	return val, nil
 }
 
+func hasKey(data interface{}, key string) bool {
+	asMap, ok := data.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	_, ok = asMap[key]
+	return ok
+}
+
+// NotFound is a sentinel value returned by Evaluator.ContextValue when there
+// is no value at the requested path.
+type NotFound struct{}
+
 type pathTypeMismatch struct{}
-type notFound struct{}
 type unknownPathType struct{}
 
+// wildcardMatches holds values collected by wildcard path elements.
+type wildcardMatches []interface{}
+
 func recursiveGet(data interface{}, path []interface{}) interface{} {
 	if len(path) == 0 {
-		switch data.(type) {
-		case string:
-			return data.(string)
-		case float64:
-			return data.(float64)
-		case bool:
-			return data.(bool)
-		case nil:
-			return nil
-		case []interface{}:
-			return data
-		case map[string]interface{}:
-			return data
-		}
+		return data
 	}
 
-	switch path[0].(type) {
+	switch key := path[0].(type) {
 	case string:
-		switch data.(type) {
+		if key == wildcard {
+			return wildcardGet(data, path[1:])
+		}
+
+		switch v := data.(type) {
 		case map[string]interface{}:
-			for k, v := range data.(map[string]interface{}) {
-				if k == path[0].(string) {
-					return recursiveGet(v, path[1:])
-				}
+			child, ok := v[key]
+			if !ok {
+				return NotFound{}
+			}
+			return recursiveGet(child, path[1:])
+		default:
+			return pathTypeMismatch{}
+		}
+	case pathToken:
+		if key == wildcard {
+			return wildcardGet(data, path[1:])
+		}
+
+		switch v := data.(type) {
+		case map[string]interface{}:
+			child, ok := v[string(key)]
+			if !ok {
+				return NotFound{}
+			}
+			return recursiveGet(child, path[1:])
+		case []interface{}:
+			index, err := strconv.Atoi(string(key))
+			if err != nil {
+				return pathTypeMismatch{}
 			}
-			return notFound{}
+			return indexGet(v, index, path[1:])
 		default:
 			return pathTypeMismatch{}
 		}
 	case float64:
 		// When parsing JSON we do not get ints, only floats. This is why we're
 		// casting float64 to int
-		switch data.(type) {
+		switch v := data.(type) {
 		case []interface{}:
-			for i, v := range data.([]interface{}) {
-				if i == int(path[0].(float64)) {
-					return recursiveGet(v, path[1:])
-				}
-			}
-			return notFound{}
+			return indexGet(v, int(key), path[1:])
 		default:
 			return pathTypeMismatch{}
 		}
@@ -375,43 +927,80 @@ func recursiveGet(data interface{}, path []interface{}) interface{} {
 	return unknownPathType{}
 }
 
-func castToBool(a interface{}) bool {
+// indexGet returns the value at path in the array element at index. Negative
+// indexes count from the end of the array.
+func indexGet(data []interface{}, index int, path []interface{}) interface{} {
+	if index < 0 {
+		index += len(data)
+	}
+
+	if index < 0 || index >= len(data) {
+		return NotFound{}
+	}
+
+	return recursiveGet(data[index], path)
+}
+
+// wildcardGet collects values at path in every element of an array or every
+// value of an object, in key order. Elements that have no value at path are
+// skipped.
+func wildcardGet(data interface{}, path []interface{}) interface{} {
+	var children []interface{}
+
+	switch v := data.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			children = append(children, v[key])
+		}
+	case []interface{}:
+		children = v
+	default:
+		return pathTypeMismatch{}
+	}
+
+	matches := wildcardMatches{}
+	for _, child := range children {
+		switch res := recursiveGet(child, path).(type) {
+		case wildcardMatches:
+			matches = append(matches, res...)
+		case NotFound, pathTypeMismatch:
+		case unknownPathType:
+			return res
+		default:
+			matches = append(matches, res)
+		}
+	}
+
+	return matches
+}
+
+// castToBool converts a value to a boolean according to the truthiness policy.
+func castToBool(a interface{}, truthiness Truthiness) bool {
 	switch v := a.(type) {
 	case nil:
 		return false
-	/*case string:
-		if len(v) == 0 {
-			return false
-		}
-		return true
-	case float32:
-		if v == 0 {
-			return false
-		}
-		return true
-	case float64:
-		if v == 0 {
-			return false
-		}
-		return true
-	case int32:
-		if v == 0 {
-			return false
-		}
-		return true
-	case int64:
-		if v == 0 {
-			return false
-		}
-		return true
-	case int:
-		if v == 0 {
-			return false
-		}
-		return true
-	*/
 	case bool:
 		return v
 	}
+
+	if truthiness == TruthinessNonEmpty {
+		switch v := a.(type) {
+		case string:
+			return len(v) > 0
+		case float64:
+			return v != 0
+		case []interface{}:
+			return len(v) > 0
+		case map[string]interface{}:
+			return len(v) > 0
+		}
+	}
+
 	return true
 }
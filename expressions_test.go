@@ -1,6 +1,9 @@
 package condition
 
 import (
+	"fmt"
+	"math"
+	"reflect"
 	"testing"
 )
 
@@ -342,6 +345,18 @@ func TestEq(t *testing.T) {
 			in:  `{"eq": [{"or": [true]}, {"and": [true]}]}`,
 			out: true,
 		},
+		{
+			in:  `{"eq": [1, 1, 1]}`,
+			out: false,
+		},
+		{
+			in:  `{"eq": [1]}`,
+			out: false,
+		},
+		{
+			in:  `{"eq": 1}`,
+			out: false,
+		},
 	}
 
 	for _, test := range testCases {
@@ -362,6 +377,22 @@ func TestEq(t *testing.T) {
 	}
 }
 
+func TestEqUncomparable(t *testing.T) {
+	evaluator := NewEvaluator()
+	evaluator.AddHandler("eq", EqExpressionHandler)
+
+	for _, in := range []string{`{"eq": [[1], [1]]}`, `{"eq": [1, [1]]}`} {
+		root, err := Parse(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := evaluator.Evaluate(nil, root); ErrorKindOf(err) != ErrorKindType {
+			t.Errorf("%s: expected a type error, got %v", in, err)
+		}
+	}
+}
+
 func TestHashmod(t *testing.T) {
 	evaluator := NewEvaluator()
 	evaluator.AddHandler("sha1mod", Sha1modExpressionHandler)
@@ -386,6 +417,18 @@ func TestHashmod(t *testing.T) {
 			in:  `{"sha1mod": [100, 100]}`,
 			out: float64(41),
 		},
+		{
+			in:  `{"sha1mod": ["value", 100, null]}`,
+			out: float64(3),
+		},
+		{
+			in:  `{"sha1mod": ["value", 100, ""]}`,
+			out: float64(3),
+		},
+		{
+			in:  `{"sha1mod": ["value", 100, "exp"]}`,
+			out: float64(14),
+		},
 	}
 
 	for _, test := range testCases {
@@ -405,6 +448,115 @@ func TestHashmod(t *testing.T) {
 	}
 }
 
+func TestHashmodAlgorithms(t *testing.T) {
+	evaluator := NewEvaluator()
+	evaluator.AddFunction("hashmod", builtinFunctions["hashmod"])
+	evaluator.AddFunction("bucket", builtinFunctions["bucket"])
+
+	testCases := []struct {
+		in  string
+		out interface{}
+	}{
+		{
+			in:  `{"hashmod": ["sha1", "value", 100]}`,
+			out: float64(3),
+		},
+		{
+			in:  `{"hashmod": ["murmur3", "value", 100]}`,
+			out: float64(2),
+		},
+		{
+			in:  `{"hashmod": ["xxhash", "value", 100]}`,
+			out: float64(50),
+		},
+		{
+			in:  `{"hashmod": ["fnv", "value", 100]}`,
+			out: float64(4),
+		},
+		{
+			in:  `{"hashmod": ["fnv", "value", 100, "exp"]}`,
+			out: float64(37),
+		},
+		{
+			in:  `{"bucket": ["value"]}`,
+			out: 0.4343261920503777,
+		},
+		{
+			in:  `{"bucket": ["value", "exp"]}`,
+			out: 0.11638156659187904,
+		},
+		{
+			in:  `{"bucket": ["value", null, "murmur3"]}`,
+			out: 0.5975317447446287,
+		},
+	}
+
+	for _, test := range testCases {
+		root, err := Parse(test.in)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test.in, err.Error())
+		} else {
+			res, err := evaluator.Evaluate(nil, root)
+			if err != nil {
+				t.Errorf("%q got an error: %s", test.in, err.Error())
+			} else {
+				if res != test.out {
+					t.Errorf("%q expected %v got %v", test.in, test.out, res)
+				}
+			}
+		}
+	}
+
+	errorCases := []string{
+		`{"hashmod": ["md4", "value", 100]}`,
+		`{"hashmod": ["sha1", "value", 0]}`,
+		`{"hashmod": ["sha1", "value", 100, 1]}`,
+		`{"bucket": ["value", null, "md4"]}`,
+		`{"bucket": []}`,
+	}
+
+	for _, test := range errorCases {
+		root, err := Parse(test)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test, err.Error())
+		} else if _, err := evaluator.Evaluate(nil, root); err == nil {
+			t.Errorf("%q expected an error", test)
+		}
+	}
+}
+
+func TestBucketRange(t *testing.T) {
+	evaluator := NewEvaluator()
+	evaluator.AddHandler("bucket", BucketExpressionHandler)
+	evaluator.AddHandler("context", ContextExpressionHandler)
+
+	for algorithm := range hashAlgorithms {
+		root, err := Parse(fmt.Sprintf(`{"bucket": [{"context": ["user"]}, "salt", %q]}`, algorithm))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sum := 0.0
+		samples := 10000
+		for i := 0; i < samples; i++ {
+			res, err := evaluator.Evaluate(map[string]interface{}{"user": float64(i)}, root)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			value := res.(float64)
+			if value < 0 || value >= 1 {
+				t.Errorf("%s bucket out of range: %v", algorithm, value)
+			}
+			sum += value
+		}
+
+		if mean := sum / float64(samples); math.Abs(mean-0.5) > 0.02 {
+			t.Errorf("%s expected mean bucket close to 0.5 got %v", algorithm, mean)
+		}
+	}
+}
+
 func TestIf(t *testing.T) {
 	evaluator := Evaluator{
 		funcs: map[string]ExpressionFunc{
@@ -525,3 +677,603 @@ func TestContext(t *testing.T) {
 		}
 	}
 }
+
+func TestLet(t *testing.T) {
+	calls := 0
+	evaluator := NewDefaultEvaluator()
+	evaluator.AddHandler("count", func(e *Evaluator, n *Node) (interface{}, error) {
+		calls++
+		return float64(calls), nil
+	})
+
+	testCases := []struct {
+		in    string
+		out   interface{}
+		calls int
+	}{
+		{
+			in:  `{"let": [{"a": 1}, {"var": "a"}]}`,
+			out: float64(1),
+		},
+		{
+			in:  `{"let": [{"a": 1}, {"b": {"var": ["a"]}}, {"eq": [{"var": "a"}, {"var": "b"}]}]}`,
+			out: true,
+		},
+		{
+			in:  `{"let": [{"a": 1}, {"let": [{"a": 2}, {"var": "a"}]}]}`,
+			out: float64(2),
+		},
+		{
+			in:  `{"let": [{"a": 1}, {"let": [{"b": 2}, {"var": "a"}]}]}`,
+			out: float64(1),
+		},
+		{
+			in:  `{"let": [{"a": 1}, {"let": [{"a": {"var": "a"}}, {"var": "a"}]}]}`,
+			out: float64(1),
+		},
+		{
+			in:    `{"let": [{"a": {"count": []}}, {"and": [{"var": "a"}, {"var": "a"}, {"eq": [{"var": "a"}, 1]}]}]}`,
+			out:   true,
+			calls: 1,
+		},
+		{
+			in:    `{"let": [{"a": {"count": []}}, false]}`,
+			out:   false,
+			calls: 0,
+		},
+		{
+			in:  `{"let": [{"a": 1}, {"or": [{"let": [{"a": 2}, false]}, {"eq": [{"var": "a"}, 1]}]}]}`,
+			out: true,
+		},
+	}
+
+	for _, test := range testCases {
+		calls = 0
+		root, err := Parse(test.in)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test.in, err.Error())
+		} else {
+			res, err := evaluator.Evaluate(nil, root)
+			if err != nil {
+				t.Errorf("%q got an error: %s", test.in, err.Error())
+			} else {
+				if res != test.out {
+					t.Errorf("%q expected %v got %v", test.in, test.out, res)
+				}
+				if calls != test.calls {
+					t.Errorf("%q expected %d evaluations got %d", test.in, test.calls, calls)
+				}
+			}
+		}
+	}
+}
+
+func TestLetErrors(t *testing.T) {
+	evaluator := NewDefaultEvaluator()
+
+	testCases := []string{
+		`{"var": "a"}`,
+		`{"let": [{"a": 1}, {"var": "b"}]}`,
+		`{"let": [{"a": {"var": "a"}}, {"var": "a"}]}`,
+		`{"let": [{"a": {"var": "b"}}, {"b": 1}, {"var": "a"}]}`,
+		`{"let": [{"a": 1}, {"a": 2}, {"var": "a"}]}`,
+		`{"let": [1, {"var": "a"}]}`,
+		`{"let": [{"a": 1}]}`,
+		`{"and": [{"let": [{"a": 1}, true]}, {"var": "a"}]}`,
+	}
+
+	for _, test := range testCases {
+		root, err := Parse(test)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test, err.Error())
+		} else if _, err := evaluator.Evaluate(nil, root); err == nil {
+			t.Errorf("%q expected an error", test)
+		}
+	}
+}
+
+func TestCheckVariables(t *testing.T) {
+	testCases := []struct {
+		in    string
+		names []string
+		err   bool
+	}{
+		{in: `{"let": [{"a": 1}, {"b": {"var": ["a"]}}, {"eq": [{"var": "a"}, {"var": "b"}]}]}`},
+		{in: `{"let": [{"a": 1}, {"let": [{"a": {"var": "a"}}, {"var": "a"}]}]}`},
+		{in: `{"eq": [{"var": "x"}, 1]}`, names: []string{"x"}},
+		{in: `{"var": {"context": "name"}}`},
+		{in: `{"var": "a"}`, err: true},
+		{in: `{"let": [{"a": 1}, {"var": "b"}]}`, err: true},
+		{in: `{"let": [{"a": {"var": "a"}}, {"var": "a"}]}`, err: true},
+		{in: `{"let": [{"a": {"var": "b"}}, {"b": 1}, {"var": "a"}]}`, err: true},
+		{in: `{"and": [{"let": [{"a": 1}, true]}, {"var": "a"}]}`, err: true},
+		{in: `{"if": [false, {"var": "a"}, true]}`, err: true},
+		{in: `{"let": [{"a": 1}, {"var": "x"}]}`, names: []string{"y"}, err: true},
+	}
+
+	for _, test := range testCases {
+		root, err := Parse(test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = CheckVariables(root, test.names...)
+		if test.err && ErrorKindOf(err) != ErrorKindUndefined {
+			t.Errorf("%s: expected undefined variable error, got %v", test.in, err)
+		} else if !test.err && err != nil {
+			t.Errorf("%s: unexpected error %s", test.in, err.Error())
+		}
+	}
+}
+
+func TestVariant(t *testing.T) {
+	evaluator := NewDefaultEvaluator()
+
+	testCases := []struct {
+		in  string
+		out interface{}
+	}{
+		{
+			in:  `{"variant": ["value", null, [["a", 1]]]}`,
+			out: "a",
+		},
+		{
+			in:  `{"variant": ["value", null, [["a", 0], ["b", 1], ["c", 0]]]}`,
+			out: "b",
+		},
+		{
+			// sha1mod("value", 100) is 3
+			in:  `{"variant": ["value", null, [["a", 3], ["b", 1], ["c", 96]]]}`,
+			out: "b",
+		},
+		{
+			in:  `{"variant": ["value", null, [["a", 4], ["b", 96]]]}`,
+			out: "a",
+		},
+		{
+			in:  `{"variant": ["value", "experiment-1", [["a", 50], ["b", 50]]]}`,
+			out: "b",
+		},
+		{
+			in:  `{"variant": ["value", "experiment-2", [["a", 50], ["b", 50]]]}`,
+			out: "a",
+		},
+	}
+
+	for _, test := range testCases {
+		root, err := Parse(test.in)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test.in, err.Error())
+		} else {
+			res, err := evaluator.Evaluate(nil, root)
+			if err != nil {
+				t.Errorf("%q got an error: %s", test.in, err.Error())
+			} else {
+				if res != test.out {
+					t.Errorf("%q expected %v got %v", test.in, test.out, res)
+				}
+			}
+		}
+	}
+
+	errorCases := []string{
+		`{"variant": ["value", null]}`,
+		`{"variant": ["value", 1, [["a", 1]]]}`,
+		`{"variant": ["value", null, [["a", 0]]]}`,
+		`{"variant": ["value", null, [["a", -1], ["b", 2]]]}`,
+		`{"variant": ["value", null, [["a", 0.5]]]}`,
+		`{"variant": ["value", null, [["a"]]]}`,
+		`{"variant": ["value", null, "a"]}`,
+	}
+
+	for _, test := range errorCases {
+		root, err := Parse(test)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test, err.Error())
+		} else if _, err := evaluator.Evaluate(nil, root); err == nil {
+			t.Errorf("%q expected an error", test)
+		}
+	}
+}
+
+func TestVariantMatchesSha1mod(t *testing.T) {
+	evaluator := NewDefaultEvaluator()
+	variant, err := Parse(`{"variant": [{"context": ["user"]}, null, [["a", 20], ["b", 30], ["c", 50]]]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nestedIf, err := Parse(`{"let": [
+		{"bucket": {"sha1mod": [{"context": ["user"]}, 100]}},
+		{"if": [{"lt": [{"var": "bucket"}, 20]}, "a", {"if": [{"lt": [{"var": "bucket"}, 50]}, "b", "c"]}]}
+	]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		ctx := fmt.Sprintf(`{"user": "user-%d"}`, i)
+		expected, err := evaluator.Evaluate(ctx, nestedIf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := evaluator.Evaluate(ctx, variant)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != expected {
+			t.Errorf("%s expected %v got %v", ctx, expected, res)
+		}
+	}
+}
+
+func TestVariantDistribution(t *testing.T) {
+	evaluator := NewDefaultEvaluator()
+	root, err := Parse(`{"variant": [{"context": ["user"]}, "experiment", [["a", 20], ["b", 30], ["c", 50]]]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	samples := 100000
+	counts := map[interface{}]int{}
+	for i := 0; i < samples; i++ {
+		res, err := evaluator.Evaluate(map[string]interface{}{"user": float64(i)}, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[res]++
+	}
+
+	expected := map[interface{}]float64{"a": 0.2, "b": 0.3, "c": 0.5}
+	for name, share := range expected {
+		got := float64(counts[name]) / float64(samples)
+		if math.Abs(got-share) > 0.01 {
+			t.Errorf("variant %v expected share %.2f got %.4f", name, share, got)
+		}
+	}
+}
+
+func TestCond(t *testing.T) {
+	calls := 0
+	evaluator := NewDefaultEvaluator()
+	evaluator.AddHandler("count", func(e *Evaluator, n *Node) (interface{}, error) {
+		calls++
+		return true, nil
+	})
+
+	testCases := []struct {
+		in    string
+		out   interface{}
+		calls int
+	}{
+		{
+			in:  `{"cond": ["default"]}`,
+			out: "default",
+		},
+		{
+			in:  `{"cond": [[true, "a"], "default"]}`,
+			out: "a",
+		},
+		{
+			in:  `{"cond": [[false, "a"], [{"eq": [1, 1]}, "b"], "default"]}`,
+			out: "b",
+		},
+		{
+			in:  `{"cond": [[false, "a"], [null, "b"], null]}`,
+			out: nil,
+		},
+		{
+			in:  `{"cond": [[false, "a"], [1, 2]]}`,
+			out: []interface{}{float64(1), float64(2)},
+		},
+		{
+			in:    `{"cond": [[true, "a"], [{"count": []}, {"count": []}], {"count": []}]}`,
+			out:   "a",
+			calls: 0,
+		},
+		{
+			in:    `{"cond": [[{"count": []}, "a"], [{"count": []}, "b"], "default"]}`,
+			out:   "a",
+			calls: 1,
+		},
+	}
+
+	for _, test := range testCases {
+		calls = 0
+		root, err := Parse(test.in)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test.in, err.Error())
+		} else {
+			res, err := evaluator.Evaluate(nil, root)
+			if err != nil {
+				t.Errorf("%q got an error: %s", test.in, err.Error())
+			} else {
+				if !reflect.DeepEqual(res, test.out) {
+					t.Errorf("%q expected %v got %v", test.in, test.out, res)
+				}
+				if calls != test.calls {
+					t.Errorf("%q expected %d evaluations got %d", test.in, test.calls, calls)
+				}
+			}
+		}
+	}
+
+	errorCases := []string{
+		`{"cond": []}`,
+		`{"cond": [true, "default"]}`,
+		`{"cond": [[true], "default"]}`,
+	}
+
+	for _, test := range errorCases {
+		root, err := Parse(test)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test, err.Error())
+		} else if _, err := evaluator.Evaluate(nil, root); err == nil {
+			t.Errorf("%q expected an error", test)
+		}
+	}
+}
+
+func TestSwitch(t *testing.T) {
+	calls := 0
+	evaluator := NewDefaultEvaluator()
+	evaluator.AddHandler("count", func(e *Evaluator, n *Node) (interface{}, error) {
+		calls++
+		return "x", nil
+	})
+
+	context := `{"country": "LT", "tags": ["a", "b"], "meta": {"plan": "pro"}}`
+
+	testCases := []struct {
+		in    string
+		out   interface{}
+		calls int
+	}{
+		{
+			in:  `{"switch": [{"context": ["country"]}, ["US", 1], ["LT", 2], 3]}`,
+			out: float64(2),
+		},
+		{
+			in:  `{"switch": [{"context": ["country"]}, ["US", 1], ["DE", 2], 3]}`,
+			out: float64(3),
+		},
+		{
+			in:  `{"switch": [{"context": ["country"]}, "none"]}`,
+			out: "none",
+		},
+		{
+			in:  `{"switch": [1, ["1", "string"], [1, "number"], null]}`,
+			out: "number",
+		},
+		{
+			in:  `{"switch": [{"context": ["tags"]}, [["a"], 1], [["a", "b"], 2], null]}`,
+			out: float64(2),
+		},
+		{
+			in:  `{"switch": [{"context": ["meta"]}, [{"context": ["meta"]}, "same"], null]}`,
+			out: "same",
+		},
+		{
+			in:  `{"switch": [{"context": ["missing"]}, [null, "missing"], "present"]}`,
+			out: "missing",
+		},
+		{
+			in:    `{"switch": ["LT", ["LT", "a"], [{"count": []}, {"count": []}], {"count": []}]}`,
+			out:   "a",
+			calls: 0,
+		},
+		{
+			in:    `{"switch": ["x", [{"count": []}, "a"], [{"count": []}, "b"], "c"]}`,
+			out:   "a",
+			calls: 1,
+		},
+	}
+
+	for _, test := range testCases {
+		calls = 0
+		root, err := Parse(test.in)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test.in, err.Error())
+		} else {
+			res, err := evaluator.Evaluate(context, root)
+			if err != nil {
+				t.Errorf("%q got an error: %s", test.in, err.Error())
+			} else {
+				if !reflect.DeepEqual(res, test.out) {
+					t.Errorf("%q expected %v got %v", test.in, test.out, res)
+				}
+				if calls != test.calls {
+					t.Errorf("%q expected %d evaluations got %d", test.in, test.calls, calls)
+				}
+			}
+		}
+	}
+
+	errorCases := []string{
+		`{"switch": [1]}`,
+		`{"switch": [1, 1, "default"]}`,
+		`{"switch": [1, [1, 2, 3], "default"]}`,
+	}
+
+	for _, test := range errorCases {
+		root, err := Parse(test)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test, err.Error())
+		} else if _, err := evaluator.Evaluate(context, root); err == nil {
+			t.Errorf("%q expected an error", test)
+		}
+	}
+}
+
+func TestNullHelpers(t *testing.T) {
+	context := `{
+			"key": "value",
+			"key2": 0,
+			"key3": {
+				"subkey1": null,
+				"subkey2": [1, null]
+			},
+			"key4": false,
+			"key5": null
+		}`
+	evaluator := NewDefaultEvaluator()
+
+	testCases := []struct {
+		in  string
+		out interface{}
+	}{
+		{in: `{"exists": ["key"]}`, out: true},
+		{in: `{"exists": ["key5"]}`, out: true},
+		{in: `{"exists": ["key3", "subkey1"]}`, out: true},
+		{in: `{"exists": ["key3", "subkey2", 1]}`, out: true},
+		{in: `{"exists": ["key3", "subkey2", 2]}`, out: false},
+		{in: `{"exists": ["key3", "subkey3"]}`, out: false},
+		{in: `{"exists": ["missing"]}`, out: false},
+		{in: `{"is_null": [{"context": ["key5"]}]}`, out: true},
+		{in: `{"is_null": [{"context": ["missing"]}]}`, out: true},
+		{in: `{"is_null": [{"context": ["key2"]}]}`, out: false},
+		{in: `{"is_null": [{"context": ["key4"]}]}`, out: false},
+		{in: `{"coalesce": []}`, out: nil},
+		{in: `{"coalesce": [null, {"context": ["key5"]}]}`, out: nil},
+		{in: `{"coalesce": [{"context": ["missing"]}, {"context": ["key2"]}, "x"]}`, out: float64(0)},
+		{in: `{"coalesce": [{"context": ["key4"]}, {"var": "undefined"}]}`, out: false},
+		{in: `{"default": [{"context": ["key"]}, "fallback"]}`, out: "value"},
+		{in: `{"default": [{"context": ["key5"]}, "fallback"]}`, out: "fallback"},
+		{in: `{"default": [{"context": ["key2"]}, "fallback"]}`, out: float64(0)},
+		{in: `{"type_of": [{"context": ["key"]}]}`, out: "string"},
+		{in: `{"type_of": [{"context": ["key2"]}]}`, out: "number"},
+		{in: `{"type_of": [{"context": ["key3"]}]}`, out: "object"},
+		{in: `{"type_of": [{"context": ["key3", "subkey2"]}]}`, out: "array"},
+		{in: `{"type_of": [{"context": ["key4"]}]}`, out: "boolean"},
+		{in: `{"type_of": [{"context": ["key5"]}]}`, out: "null"},
+	}
+
+	for _, test := range testCases {
+		root, err := Parse(test.in)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test.in, err.Error())
+		} else {
+			res, err := evaluator.Evaluate(context, root)
+			if err != nil {
+				t.Errorf("%q got an error: %s", test.in, err.Error())
+			} else {
+				if res != test.out {
+					t.Errorf("%q expected %v got %v", test.in, test.out, res)
+				}
+			}
+		}
+	}
+
+	errorCases := []string{
+		`{"is_null": [1, 2]}`,
+		`{"default": [1]}`,
+		`{"type_of": []}`,
+		`{"exists": 1}`,
+	}
+
+	for _, test := range errorCases {
+		root, err := Parse(test)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test, err.Error())
+		} else if _, err := evaluator.Evaluate(context, root); err == nil {
+			t.Errorf("%q expected an error", test)
+		}
+	}
+}
+
+func TestTry(t *testing.T) {
+	evaluator := NewDefaultEvaluator()
+	evaluator.AddHandler("exhausted", func(e *Evaluator, n *Node) (interface{}, error) {
+		return nil, &EvaluationError{Kind: ErrorKindLimit, Message: "limit exceeded"}
+	})
+	context := `{"spend": "not a number", "limit": 100}`
+
+	testCases := []struct {
+		in    string
+		out   interface{}
+		trace []TraceEntry
+	}{
+		{
+			in:  `{"try": [{"gt": [{"context": ["limit"]}, 10]}, false]}`,
+			out: true,
+		},
+		{
+			in:  `{"try": [{"gt": [{"context": ["spend"]}, 10]}, false]}`,
+			out: false,
+			trace: []TraceEntry{
+				{Expression: "try", Kind: ErrorKindType, Message: "gt expression: expected number as an argument"},
+			},
+		},
+		{
+			in:  `{"try": [{"gt": [{"context": ["spend"]}, 10]}, false, "type"]}`,
+			out: false,
+			trace: []TraceEntry{
+				{Expression: "try", Kind: ErrorKindType, Message: "gt expression: expected number as an argument"},
+			},
+		},
+		{
+			in:  `{"try": [{"unknown": []}, "fallback", ["type", "undefined"]]}`,
+			out: "fallback",
+			trace: []TraceEntry{
+				{Expression: "try", Kind: ErrorKindUndefined, Message: `no expression handler bound to "unknown"`},
+			},
+		},
+		{
+			in:  `{"try": [{"and": [{"gt": [1]}]}, "fallback"]}`,
+			out: "fallback",
+			trace: []TraceEntry{
+				{Expression: "try", Kind: ErrorKindArity, Message: "and expression: gt expression: expected 2 argument(s), got 1"},
+			},
+		},
+		{
+			in:  `{"try": [{"try": [{"var": "x"}, {"var": "y"}]}, "outer"]}`,
+			out: "outer",
+			trace: []TraceEntry{
+				{Expression: "try", Kind: ErrorKindUndefined, Message: `var expression: undefined variable "x"`},
+				{Expression: "try", Kind: ErrorKindUndefined, Message: `try expression: var expression: undefined variable "y"`},
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		root, err := Parse(test.in)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test.in, err.Error())
+		} else {
+			res, err := evaluator.Evaluate(context, root)
+			if err != nil {
+				t.Errorf("%q got an error: %s", test.in, err.Error())
+			} else {
+				if res != test.out {
+					t.Errorf("%q expected %v got %v", test.in, test.out, res)
+				}
+				if !reflect.DeepEqual(evaluator.Trace(), test.trace) {
+					t.Errorf("%q expected trace %v got %v", test.in, test.trace, evaluator.Trace())
+				}
+			}
+		}
+	}
+
+	errorCases := []struct {
+		in   string
+		kind ErrorKind
+	}{
+		{in: `{"try": [{"gt": [{"context": ["spend"]}, 10]}, false, "arity"]}`, kind: ErrorKindType},
+		{in: `{"try": [{"gt": [{"context": ["spend"]}, 10]}, false, ["arity", "missing"]]}`, kind: ErrorKindType},
+		{in: `{"try": [{"var": "x"}, {"var": "y"}]}`, kind: ErrorKindUndefined},
+		{in: `{"try": [{"var": "x"}, false, 1]}`, kind: ErrorKindType},
+		{in: `{"try": [true]}`, kind: ErrorKindArity},
+		{in: `{"try": [{"exhausted": []}, false]}`, kind: ErrorKindLimit},
+		{in: `{"try": [{"exhausted": []}, false, "limit"]}`, kind: ErrorKindLimit},
+	}
+
+	for _, test := range errorCases {
+		root, err := Parse(test.in)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test.in, err.Error())
+		} else if _, err := evaluator.Evaluate(context, root); err == nil {
+			t.Errorf("%q expected an error", test.in)
+		} else if ErrorKindOf(err) != test.kind {
+			t.Errorf("%q expected %s error got %s: %s", test.in, test.kind, ErrorKindOf(err), err.Error())
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package condition
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Format returns the condition JSON of n on a single line. Parsing the result
+// gives a tree equal to n.
+func Format(n *Node) (string, error) {
+	buf := &bytes.Buffer{}
+	if err := writeNode(buf, n); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// FormatIndent is like Format, but nested objects and arrays begin on a new
+// line indented with one or more copies of indent.
+func FormatIndent(n *Node, indent string) (string, error) {
+	compact := &bytes.Buffer{}
+	if err := writeNode(compact, n); err != nil {
+		return "", err
+	}
+
+	buf := &bytes.Buffer{}
+	if err := json.Indent(buf, compact.Bytes(), "", indent); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// MarshalJSON returns the condition JSON of n.
+func (n *Node) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := writeNode(buf, n); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeNode(buf *bytes.Buffer, n *Node) error {
+	if n == nil {
+		return fmt.Errorf("received nil AST node")
+	}
+
+	switch n.Type {
+	case NodeTypeLiteral:
+		switch n.Token.Value.(type) {
+		case nil, bool, float64, string:
+			return writeValue(buf, n.Token.Value)
+		}
+		return fmt.Errorf("unexpected literal value of type %T", n.Token.Value)
+	case NodeTypeArray:
+		buf.WriteByte('[')
+		for i, child := range n.Children {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeNode(buf, child); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	case NodeTypeFunction:
+		name, ok := n.Token.Value.(string)
+		if !ok {
+			return fmt.Errorf("function name is not a string")
+		}
+		if len(n.Children) != 1 {
+			return fmt.Errorf("function %q has %d children, expected 1", name, len(n.Children))
+		}
+
+		buf.WriteByte('{')
+		if err := writeValue(buf, name); err != nil {
+			return err
+		}
+		buf.WriteByte(':')
+		if err := writeNode(buf, n.Children[0]); err != nil {
+			return err
+		}
+		buf.WriteByte('}')
+		return nil
+	}
+
+	return fmt.Errorf("unexpected node type %d", n.Type)
+}
+
+// writeValue writes a JSON encoded value. HTML characters are not escaped.
+func writeValue(buf *bytes.Buffer, v interface{}) error {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+
+	// Encode terminates values with a newline.
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
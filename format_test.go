@@ -0,0 +1,152 @@
+package condition
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		expression string
+		compact    string
+		indented   string
+	}{
+		{
+			expression: `true`,
+			compact:    `true`,
+			indented:   `true`,
+		},
+		{
+			expression: `{ "and" : [ {"eq": [{"context": ["user", "name"]}, "<ann & bob>"]}, null, 1.50, [] ] }`,
+			compact:    `{"and":[{"eq":[{"context":["user","name"]},"<ann & bob>"]},null,1.5,[]]}`,
+			indented: `{
+  "and": [
+    {
+      "eq": [
+        {
+          "context": [
+            "user",
+            "name"
+          ]
+        },
+        "<ann & bob>"
+      ]
+    },
+    null,
+    1.5,
+    []
+  ]
+}`,
+		},
+		{
+			expression: `{"not": {"exists": "a\"b"}}`,
+			compact:    `{"not":{"exists":"a\"b"}}`,
+			indented: `{
+  "not": {
+    "exists": "a\"b"
+  }
+}`,
+		},
+	}
+
+	for _, test := range tests {
+		root := mustParse(t, test.expression)
+
+		compact, err := Format(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if compact != test.compact {
+			t.Errorf("%s: expected\n%s\ngot\n%s", test.expression, test.compact, compact)
+		}
+
+		indented, err := FormatIndent(root, "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if indented != test.indented {
+			t.Errorf("%s: expected\n%s\ngot\n%s", test.expression, test.indented, indented)
+		}
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	g := &conditionGenerator{rnd: rand.New(rand.NewSource(2))}
+
+	for i := 0; i < 500; i++ {
+		root := mustParse(t, g.expression(5))
+
+		for _, indent := range []string{"", "  ", "\t"} {
+			format := func(n *Node) (string, error) {
+				if indent == "" {
+					return Format(n)
+				}
+				return FormatIndent(n, indent)
+			}
+
+			formatted, err := format(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parsed := mustParse(t, formatted)
+			if !root.Equal(parsed) {
+				t.Fatalf("%q doesn't round trip", formatted)
+			}
+
+			again, err := format(parsed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again != formatted {
+				t.Fatalf("formatting is not stable:\n%s\n%s", formatted, again)
+			}
+		}
+	}
+}
+
+func TestFormatOptimized(t *testing.T) {
+	// Trees built by the optimizer can be written back.
+	root := Optimize(mustParse(t, `{"and": [true, {"if": [{"eq": [1, 1]}, {"context": "a"}]}, {"or": [{"gt": [2, 1]}]}]}`))
+
+	formatted, err := Format(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if formatted != `{"and":[{"context":"a"}]}` {
+		t.Errorf("unexpected %s", formatted)
+	}
+}
+
+func TestFormatInvalidTree(t *testing.T) {
+	invalid := []*Node{
+		nil,
+		{Type: NodeTypeFunction, Token: Token{Value: "and"}},
+		{Type: NodeTypeLiteral, Token: Token{Value: map[string]interface{}{}}},
+		{Type: NodeTypeExpression},
+	}
+
+	for _, n := range invalid {
+		if _, err := Format(n); err == nil {
+			t.Errorf("expected error for %s", getNodeName(n))
+		}
+	}
+}
+
+func TestNodeMarshalJSON(t *testing.T) {
+	msg := struct {
+		Condition *Node `json:"condition"`
+	}{
+		Condition: mustParse(t, `{"gt": [{"context": "n"}, 1]}`),
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != `{"condition":{"gt":[{"context":"n"},1]}}` {
+		t.Errorf("unexpected %s", data)
+	}
+}
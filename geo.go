@@ -0,0 +1,395 @@
+package condition
+
+import (
+	"math"
+)
+
+const (
+	earthRadiusKm = 6371.0
+	kmPerMile     = 1.609344
+)
+
+// geoRing is a closed ring of [longitude, latitude] positions. Longitudes are
+// unwrapped so that consecutive positions never differ by more than 180
+// degrees, which keeps rings crossing the antimeridian contiguous.
+type geoRing [][2]float64
+
+// geoPolygon is a polygon with an outer ring and optional holes. The bounding
+// box of the outer ring is used to quickly reject points.
+type geoPolygon struct {
+	rings []geoRing
+
+	minLon, maxLon float64
+	minLat, maxLat float64
+}
+
+// geoShape is a union of polygons. It is the compiled form of GeoJSON Polygon
+// and MultiPolygon geometries.
+type geoShape []*geoPolygon
+
+// evaluatePoint evaluates the argument at index i as a point given as a
+// [lat, lon] pair or an object with "lat" and "lon" (or "lng") keys.
+func evaluatePoint(args *Args, i int) (float64, float64, error) {
+	res, err := args.Value(i)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var lat, lon interface{}
+	switch v := res.(type) {
+	case []interface{}:
+		if len(v) != 2 {
+			return 0, 0, newError(ErrorKindValue, "expected point as a [lat, lon] pair, got %d values", len(v))
+		}
+		lat, lon = v[0], v[1]
+	case map[string]interface{}:
+		lat = v["lat"]
+		if lon = v["lon"]; lon == nil {
+			lon = v["lng"]
+		}
+	default:
+		return 0, 0, newError(ErrorKindType, "expected point as a [lat, lon] pair or an object, got %s", typeOf(res))
+	}
+
+	latFloat, latOk := lat.(float64)
+	lonFloat, lonOk := lon.(float64)
+	if !latOk || !lonOk {
+		return 0, 0, newError(ErrorKindType, "expected point latitude and longitude as numbers")
+	}
+
+	if latFloat < -90 || latFloat > 90 || lonFloat < -180 || lonFloat > 180 {
+		return 0, 0, newError(ErrorKindValue, "point [%v, %v] is out of range", latFloat, lonFloat)
+	}
+
+	return latFloat, lonFloat, nil
+}
+
+// evaluateUnit evaluates an optional distance unit argument at index i and
+// returns the number of kilometers in one unit. Kilometers are used by
+// default.
+func evaluateUnit(args *Args, i int) (float64, error) {
+	if !args.Has(i) {
+		return 1, nil
+	}
+
+	unit, err := evaluateString(args, i)
+	if err != nil {
+		return 0, err
+	}
+
+	switch unit {
+	case "km":
+		return 1, nil
+	case "mi":
+		return kmPerMile, nil
+	}
+
+	return 0, newError(ErrorKindValue, "unknown distance unit %q, expected \"km\" or \"mi\"", unit)
+}
+
+// haversine returns the great circle distance between two points in
+// kilometers.
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := math.Pi / 180
+	dLat := (lat2 - lat1) * toRad
+	dLon := (lon2 - lon1) * toRad
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// GeoDistanceExpressionHandler returns the great circle distance between two
+// points. It takes two points and an optional unit, "km" (default) or "mi".
+func GeoDistanceExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	args := NewArgs(e, n)
+	lat1, lon1, err := evaluatePoint(args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	lat2, lon2, err := evaluatePoint(args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	unit, err := evaluateUnit(args, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	return haversine(lat1, lon1, lat2, lon2) / unit, nil
+}
+
+// GeoWithinRadiusExpressionHandler returns true if a point is at most radius
+// away from a center point. It takes the point, the center, the radius and an
+// optional unit, "km" (default) or "mi".
+func GeoWithinRadiusExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	args := NewArgs(e, n)
+	lat, lon, err := evaluatePoint(args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	centerLat, centerLon, err := evaluatePoint(args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := args.Value(2)
+	if err != nil {
+		return nil, err
+	}
+
+	radius, ok := res.(float64)
+	if !ok {
+		return nil, newError(ErrorKindType, errExpectedNumber)
+	}
+
+	unit, err := evaluateUnit(args, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	return haversine(lat, lon, centerLat, centerLon) <= radius*unit, nil
+}
+
+// GeoInPolygonExpressionHandler returns true if a point is inside a polygon.
+// It takes the point and a GeoJSON Polygon or MultiPolygon geometry, either as
+// an object or as bare polygon coordinates. Polygon literals are compiled on
+// first use and the result is cached on the argument node.
+func GeoInPolygonExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	args := NewArgs(e, n)
+	lat, lon, err := evaluatePoint(args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	shape, err := evaluateGeoShape(args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return shape.contains(lat, lon), nil
+}
+
+// evaluateGeoShape evaluates and compiles the polygon argument at index i.
+// Constant polygons are compiled once and cached on the argument node.
+func evaluateGeoShape(args *Args, i int) (geoShape, error) {
+	n, err := args.node(i)
+	if err != nil {
+		return nil, err
+	}
+
+	if shape, ok := n.compiled.Load().(geoShape); ok {
+		return shape, nil
+	}
+
+	value, constant := literalValue(n)
+	if !constant {
+		res, err := args.Value(i)
+		if err != nil {
+			return nil, err
+		}
+		return compileGeoShape(res)
+	}
+
+	shape, err := compileGeoShape(value)
+	if err != nil {
+		return nil, err
+	}
+	n.compiled.Store(shape)
+
+	return shape, nil
+}
+
+// compileGeoShape compiles a GeoJSON geometry or Feature object, or bare
+// Polygon or MultiPolygon coordinates.
+func compileGeoShape(v interface{}) (geoShape, error) {
+	switch geometry := v.(type) {
+	case map[string]interface{}:
+		switch geometry["type"] {
+		case "Feature":
+			return compileGeoShape(geometry["geometry"])
+		case "Polygon":
+			polygon, err := compileGeoPolygon(geometry["coordinates"])
+			if err != nil {
+				return nil, err
+			}
+			return geoShape{polygon}, nil
+		case "MultiPolygon":
+			return compileGeoMultiPolygon(geometry["coordinates"])
+		}
+		return nil, newError(ErrorKindValue, "expected GeoJSON Polygon or MultiPolygon, got %v", geometry["type"])
+	case []interface{}:
+		if isMultiPolygon(geometry) {
+			return compileGeoMultiPolygon(geometry)
+		}
+
+		polygon, err := compileGeoPolygon(geometry)
+		if err != nil {
+			return nil, err
+		}
+		return geoShape{polygon}, nil
+	}
+
+	return nil, newError(ErrorKindType, "expected GeoJSON polygon, got %s", typeOf(v))
+}
+
+// isMultiPolygon checks if coordinates are nested four levels deep.
+func isMultiPolygon(coordinates []interface{}) bool {
+	var v interface{} = coordinates
+	for depth := 0; depth < 3; depth++ {
+		list, ok := v.([]interface{})
+		if !ok || len(list) == 0 {
+			return false
+		}
+		v = list[0]
+	}
+
+	_, ok := v.([]interface{})
+	return ok
+}
+
+func compileGeoMultiPolygon(v interface{}) (geoShape, error) {
+	coordinates, ok := v.([]interface{})
+	if !ok {
+		return nil, newError(ErrorKindType, "expected MultiPolygon coordinates as a list of polygons")
+	}
+
+	shape := make(geoShape, len(coordinates))
+	for i, polygonCoordinates := range coordinates {
+		polygon, err := compileGeoPolygon(polygonCoordinates)
+		if err != nil {
+			return nil, err
+		}
+		shape[i] = polygon
+	}
+
+	return shape, nil
+}
+
+func compileGeoPolygon(v interface{}) (*geoPolygon, error) {
+	coordinates, ok := v.([]interface{})
+	if !ok || len(coordinates) == 0 {
+		return nil, newError(ErrorKindType, "expected Polygon coordinates as a list of rings")
+	}
+
+	polygon := &geoPolygon{
+		minLon: math.Inf(1),
+		maxLon: math.Inf(-1),
+		minLat: math.Inf(1),
+		maxLat: math.Inf(-1),
+	}
+
+	for i, ringCoordinates := range coordinates {
+		ring, err := compileGeoRing(ringCoordinates)
+		if err != nil {
+			return nil, err
+		}
+
+		if i > 0 {
+			// Move holes next to the outer ring if they were unwrapped on
+			// the other side of the antimeridian.
+			shift := math.Round((polygon.rings[0][0][0]-ring[0][0])/360) * 360
+			for j := range ring {
+				ring[j][0] += shift
+			}
+		}
+
+		polygon.rings = append(polygon.rings, ring)
+	}
+
+	for _, position := range polygon.rings[0] {
+		polygon.minLon = math.Min(polygon.minLon, position[0])
+		polygon.maxLon = math.Max(polygon.maxLon, position[0])
+		polygon.minLat = math.Min(polygon.minLat, position[1])
+		polygon.maxLat = math.Max(polygon.maxLat, position[1])
+	}
+
+	return polygon, nil
+}
+
+func compileGeoRing(v interface{}) (geoRing, error) {
+	positions, ok := v.([]interface{})
+	if !ok || len(positions) < 3 {
+		return nil, newError(ErrorKindValue, "expected polygon ring as a list of at least 3 positions")
+	}
+
+	ring := make(geoRing, len(positions))
+	for i, position := range positions {
+		pair, ok := position.([]interface{})
+		if !ok || len(pair) < 2 {
+			return nil, newError(ErrorKindValue, "expected polygon position as a [lon, lat] pair")
+		}
+
+		lon, lonOk := pair[0].(float64)
+		lat, latOk := pair[1].(float64)
+		if !lonOk || !latOk {
+			return nil, newError(ErrorKindType, "expected polygon position longitude and latitude as numbers")
+		}
+
+		if i > 0 {
+			previous := ring[i-1][0]
+			for lon-previous > 180 {
+				lon -= 360
+			}
+			for lon-previous < -180 {
+				lon += 360
+			}
+		}
+
+		ring[i] = [2]float64{lon, lat}
+	}
+
+	return ring, nil
+}
+
+func (s geoShape) contains(lat, lon float64) bool {
+	for _, polygon := range s {
+		// Unwrapped polygons may extend past ±180 degrees, so the point is
+		// also checked one turn around the globe in both directions.
+		for _, offset := range []float64{0, 360, -360} {
+			if polygon.contains(lat, lon+offset) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (p *geoPolygon) contains(lat, lon float64) bool {
+	if lon < p.minLon || lon > p.maxLon || lat < p.minLat || lat > p.maxLat {
+		return false
+	}
+
+	if !p.rings[0].contains(lat, lon) {
+		return false
+	}
+
+	for _, hole := range p.rings[1:] {
+		if hole.contains(lat, lon) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// contains checks if a point is inside the ring using the even-odd rule,
+// treating coordinates as planar.
+func (r geoRing) contains(lat, lon float64) bool {
+	inside := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		xi, yi := r[i][0], r[i][1]
+		xj, yj := r[j][0], r[j][1]
+
+		if (yi > lat) != (yj > lat) && lon < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
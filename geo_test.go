@@ -0,0 +1,200 @@
+package condition
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGeoDistance(t *testing.T) {
+	evaluator := NewDefaultEvaluator()
+
+	testCases := []struct {
+		in  string
+		ctx interface{}
+		out float64
+	}{
+		{in: `{"geo_distance": [[51.5074, -0.1278], [48.8566, 2.3522]]}`, out: 343.556},
+		{in: `{"geo_distance": [[51.5074, -0.1278], [48.8566, 2.3522], "km"]}`, out: 343.556},
+		{in: `{"geo_distance": [[51.5074, -0.1278], [48.8566, 2.3522], "mi"]}`, out: 213.475},
+		{in: `{"geo_distance": [[0, 179.5], [0, -179.5]]}`, out: 111.195},
+		{in: `{"geo_distance": [[10, 10], [10, 10]]}`, out: 0},
+		{
+			in: `{"geo_distance": [{"context": ["location"]}, [54.6872, 25.2797]]}`,
+			ctx: map[string]interface{}{
+				"location": map[string]interface{}{"lat": 54.8985, "lng": 23.9036},
+			},
+			out: 91.292,
+		},
+	}
+
+	for _, test := range testCases {
+		root, err := Parse(test.in)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test.in, err.Error())
+		} else {
+			res, err := evaluator.Evaluate(test.ctx, root)
+			if err != nil {
+				t.Errorf("%q got an error: %s", test.in, err.Error())
+			} else if distance, ok := res.(float64); !ok || math.Abs(distance-test.out) > 0.001 {
+				t.Errorf("%q expected %v got %v", test.in, test.out, res)
+			}
+		}
+	}
+}
+
+func TestGeo(t *testing.T) {
+	evaluator := NewDefaultEvaluator()
+
+	square := []interface{}{
+		[]interface{}{
+			[]interface{}{0.0, 0.0}, []interface{}{10.0, 0.0}, []interface{}{10.0, 10.0},
+			[]interface{}{0.0, 10.0}, []interface{}{0.0, 0.0},
+		},
+	}
+	ctx := map[string]interface{}{
+		"point": []interface{}{5.0, 5.0},
+		"region": map[string]interface{}{
+			"type":        "Polygon",
+			"coordinates": square,
+		},
+		"regions": map[string]interface{}{
+			"type":        "MultiPolygon",
+			"coordinates": []interface{}{square},
+		},
+		"feature": map[string]interface{}{
+			"type": "Feature",
+			"geometry": map[string]interface{}{
+				"type":        "Polygon",
+				"coordinates": square,
+			},
+		},
+	}
+
+	withHole := `[[[0, 0], [10, 0], [10, 10], [0, 10], [0, 0]], [[4, 4], [6, 4], [6, 6], [4, 6], [4, 4]]]`
+	// Fiji-like box crossing the antimeridian.
+	antimeridian := `[[[178, -20], [-178, -20], [-178, -15], [178, -15], [178, -20]]]`
+	// The same box with a hole that crosses the antimeridian too.
+	antimeridianWithHole := `[[[178, -20], [-178, -20], [-178, -15], [178, -15], [178, -20]], [[-179.5, -18], [179.5, -18], [179.5, -17], [-179.5, -17], [-179.5, -18]]]`
+	multi := `[[[[0, 0], [1, 0], [1, 1], [0, 1], [0, 0]]], [[[20, 20], [21, 20], [21, 21], [20, 21], [20, 20]]]]`
+
+	testCases := []struct {
+		in  string
+		out bool
+	}{
+		{in: `{"geo_within_radius": [[51.5074, -0.1278], [48.8566, 2.3522], 350]}`, out: true},
+		{in: `{"geo_within_radius": [[51.5074, -0.1278], [48.8566, 2.3522], 340]}`, out: false},
+		{in: `{"geo_within_radius": [[51.5074, -0.1278], [48.8566, 2.3522], 214, "mi"]}`, out: true},
+		{in: `{"geo_within_radius": [[51.5074, -0.1278], [48.8566, 2.3522], 213, "mi"]}`, out: false},
+		{in: `{"geo_within_radius": [[0, 179.9], [0, -179.9], 25]}`, out: true},
+		{in: `{"geo_in_polygon": [[2, 2], ` + withHole + `]}`, out: true},
+		{in: `{"geo_in_polygon": [[5, 5], ` + withHole + `]}`, out: false},
+		{in: `{"geo_in_polygon": [[11, 5], ` + withHole + `]}`, out: false},
+		{in: `{"geo_in_polygon": [[-17, 179], ` + antimeridian + `]}`, out: true},
+		{in: `{"geo_in_polygon": [[-17, -179], ` + antimeridian + `]}`, out: true},
+		{in: `{"geo_in_polygon": [[-17, 180], ` + antimeridian + `]}`, out: true},
+		{in: `{"geo_in_polygon": [[-17, 177], ` + antimeridian + `]}`, out: false},
+		{in: `{"geo_in_polygon": [[-17, 0], ` + antimeridian + `]}`, out: false},
+		{in: `{"geo_in_polygon": [[-21, 179], ` + antimeridian + `]}`, out: false},
+		{in: `{"geo_in_polygon": [[-17.5, 179.9], ` + antimeridianWithHole + `]}`, out: false},
+		{in: `{"geo_in_polygon": [[-17.5, -179.9], ` + antimeridianWithHole + `]}`, out: false},
+		{in: `{"geo_in_polygon": [[-19, 179.9], ` + antimeridianWithHole + `]}`, out: true},
+		{in: `{"geo_in_polygon": [[-17.5, 178.5], ` + antimeridianWithHole + `]}`, out: true},
+		{in: `{"geo_in_polygon": [[0.5, 0.5], ` + multi + `]}`, out: true},
+		{in: `{"geo_in_polygon": [[20.5, 20.5], ` + multi + `]}`, out: true},
+		{in: `{"geo_in_polygon": [[10, 10], ` + multi + `]}`, out: false},
+		{in: `{"geo_in_polygon": [{"context": ["point"]}, {"context": ["region"]}]}`, out: true},
+		{in: `{"geo_in_polygon": [{"context": ["point"]}, {"context": ["regions"]}]}`, out: true},
+		{in: `{"geo_in_polygon": [{"context": ["point"]}, {"context": ["feature"]}]}`, out: true},
+		{in: `{"geo_in_polygon": [[5, 5], {"context": ["region", "coordinates"]}]}`, out: true},
+		{in: `{"geo_in_polygon": [[15, 5], {"context": ["region"]}]}`, out: false},
+	}
+
+	for _, test := range testCases {
+		root, err := Parse(test.in)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test.in, err.Error())
+		} else {
+			res, err := evaluator.Evaluate(ctx, root)
+			if err != nil {
+				t.Errorf("%q got an error: %s", test.in, err.Error())
+			} else if res != test.out {
+				t.Errorf("%q expected %v got %v", test.in, test.out, res)
+			}
+		}
+	}
+
+	errorCases := []string{
+		`{"geo_distance": [[0, 0]]}`,
+		`{"geo_distance": [[0, 0], [91, 0]]}`,
+		`{"geo_distance": [[0, 0], [0, 181]]}`,
+		`{"geo_distance": [[0, 0], [0, 1, 2]]}`,
+		`{"geo_distance": [[0, 0], ["0", 1]]}`,
+		`{"geo_distance": [[0, 0], [0, 1], "parsec"]}`,
+		`{"geo_distance": [[0, 0], {"context": ["missing"]}]}`,
+		`{"geo_within_radius": [[0, 0], [0, 1], "10"]}`,
+		`{"geo_in_polygon": [[0, 0]]}`,
+		`{"geo_in_polygon": [[0, 0], []]}`,
+		`{"geo_in_polygon": [[0, 0], [[[0, 0], [1, 1]]]]}`,
+		`{"geo_in_polygon": [[0, 0], [[[0, 0], [1, "1"], [1, 0]]]]}`,
+		`{"geo_in_polygon": [[0, 0], {"context": ["point"]}]}`,
+		`{"geo_in_polygon": [[0, 0], "polygon"]}`,
+	}
+
+	for _, test := range errorCases {
+		root, err := Parse(test)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test, err.Error())
+		} else if _, err := evaluator.Evaluate(ctx, root); err == nil {
+			t.Errorf("%q expected an error", test)
+		}
+	}
+}
+
+func TestGeoPolygonCompiledOnce(t *testing.T) {
+	root, err := Parse(`{"and": [{"inside": [{"context": ["point"]}, [[[0, 0], [10, 0], [10, 10], [0, 10], [0, 0]]]]}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	polygon := root.Children[0].Children[0].Children[0].Children[1]
+	if polygon.compiled.Load() != nil {
+		t.Fatalf("expected polygon not to be compiled by Parse")
+	}
+
+	// The polygon is compiled on first use, whatever the function is called.
+	evaluator := NewDefaultEvaluator()
+	evaluator.AddFunction("inside", builtinFunctions["geo_in_polygon"])
+	ctx := map[string]interface{}{"point": []interface{}{5.0, 5.0}}
+	if _, err := evaluator.Evaluate(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+
+	shape, ok := polygon.compiled.Load().(geoShape)
+	if !ok || len(shape) != 1 {
+		t.Fatalf("expected polygon to be compiled, got %#v", polygon.compiled.Load())
+	}
+
+	// Evaluation must use the compiled polygon rather than the literal.
+	polygon.Children = nil
+	res, err := evaluator.Evaluate(ctx, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != true {
+		t.Errorf("expected true got %v", res)
+	}
+
+	root, err = Parse(`{"geo_in_polygon": [[0, 0], {"context": ["region"]}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	region := map[string]interface{}{"region": []interface{}{[]interface{}{
+		[]interface{}{-1.0, -1.0}, []interface{}{1.0, -1.0}, []interface{}{1.0, 1.0}, []interface{}{-1.0, -1.0},
+	}}}
+	if res, err := evaluator.Evaluate(region, root); err != nil || res != true {
+		t.Fatalf("expected true got %v, %v", res, err)
+	}
+	if root.Children[0].Children[1].compiled.Load() != nil {
+		t.Errorf("expected polygon from context not to be compiled")
+	}
+}
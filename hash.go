@@ -0,0 +1,177 @@
+package condition
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/json"
+	"hash/fnv"
+	"math/bits"
+)
+
+// hashAlgorithm computes a non-cryptographic digest used for bucketing. Size
+// is the number of significant bits in the digest.
+type hashAlgorithm struct {
+	sum  func([]byte) uint64
+	size uint
+}
+
+var hashAlgorithms = map[string]hashAlgorithm{
+	"sha1":    {sum: sha1Sum64, size: 64},
+	"murmur3": {sum: func(data []byte) uint64 { return uint64(murmur3Sum32(data, 0)) }, size: 32},
+	"xxhash":  {sum: func(data []byte) uint64 { return xxhashSum64(data, 0) }, size: 64},
+	"fnv":     {sum: fnv1aSum64, size: 64},
+}
+
+// hashKey hashes JSON encoded key with the named algorithm. Non-empty salt is
+// prepended to the encoded key, separated by a colon.
+func hashKey(algorithm string, key interface{}, salt string) (uint64, hashAlgorithm, error) {
+	alg, ok := hashAlgorithms[algorithm]
+	if !ok {
+		return 0, alg, newError(ErrorKindValue, "unknown hash algorithm %q", algorithm)
+	}
+
+	keyValue, err := json.Marshal(key)
+	if err != nil {
+		return 0, alg, err
+	}
+
+	if salt != "" {
+		keyValue = append([]byte(salt+":"), keyValue...)
+	}
+
+	return alg.sum(keyValue), alg, nil
+}
+
+// sha1Sum64 returns the first 8 bytes of the SHA1 digest as a big endian
+// integer.
+func sha1Sum64(data []byte) uint64 {
+	hash := sha1.Sum(data)
+	return binary.BigEndian.Uint64(hash[:8])
+}
+
+// fnv1aSum64 returns the 64 bit FNV-1a digest.
+func fnv1aSum64(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
+
+// murmur3Sum32 returns the 32 bit x86 variant of MurmurHash3.
+func murmur3Sum32(data []byte, seed uint32) uint32 {
+	const (
+		c1 = 0xcc9e2d51
+		c2 = 0x1b873593
+	)
+
+	h := seed
+	nblocks := len(data) / 4
+	for i := 0; i < nblocks; i++ {
+		k := binary.LittleEndian.Uint32(data[i*4:])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+
+	tail := data[nblocks*4:]
+	var k uint32
+	switch len(tail) {
+	case 3:
+		k ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(tail[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+
+	h ^= uint32(len(data))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+
+	return h
+}
+
+const (
+	xxhashPrime1 uint64 = 11400714785074694791
+	xxhashPrime2 uint64 = 14029467366897019727
+	xxhashPrime3 uint64 = 1609587929392839161
+	xxhashPrime4 uint64 = 9650029242287828579
+	xxhashPrime5 uint64 = 2870177450012600261
+)
+
+func xxhashRound(acc, input uint64) uint64 {
+	acc += input * xxhashPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxhashPrime1
+}
+
+func xxhashMergeRound(acc, val uint64) uint64 {
+	acc ^= xxhashRound(0, val)
+	return acc*xxhashPrime1 + xxhashPrime4
+}
+
+// xxhashSum64 returns the XXH64 digest.
+func xxhashSum64(data []byte, seed uint64) uint64 {
+	n := len(data)
+	var h uint64
+
+	if n >= 32 {
+		v1 := seed + xxhashPrime1 + xxhashPrime2
+		v2 := seed + xxhashPrime2
+		v3 := seed
+		v4 := seed - xxhashPrime1
+		for len(data) >= 32 {
+			v1 = xxhashRound(v1, binary.LittleEndian.Uint64(data[0:]))
+			v2 = xxhashRound(v2, binary.LittleEndian.Uint64(data[8:]))
+			v3 = xxhashRound(v3, binary.LittleEndian.Uint64(data[16:]))
+			v4 = xxhashRound(v4, binary.LittleEndian.Uint64(data[24:]))
+			data = data[32:]
+		}
+
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) + bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		h = xxhashMergeRound(h, v1)
+		h = xxhashMergeRound(h, v2)
+		h = xxhashMergeRound(h, v3)
+		h = xxhashMergeRound(h, v4)
+	} else {
+		h = seed + xxhashPrime5
+	}
+
+	h += uint64(n)
+
+	for ; len(data) >= 8; data = data[8:] {
+		h ^= xxhashRound(0, binary.LittleEndian.Uint64(data))
+		h = bits.RotateLeft64(h, 27)*xxhashPrime1 + xxhashPrime4
+	}
+
+	if len(data) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(data)) * xxhashPrime1
+		h = bits.RotateLeft64(h, 23)*xxhashPrime2 + xxhashPrime3
+		data = data[4:]
+	}
+
+	for ; len(data) > 0; data = data[1:] {
+		h ^= uint64(data[0]) * xxhashPrime5
+		h = bits.RotateLeft64(h, 11) * xxhashPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxhashPrime2
+	h ^= h >> 29
+	h *= xxhashPrime3
+	h ^= h >> 32
+
+	return h
+}
@@ -0,0 +1,41 @@
+package condition
+
+import (
+	"testing"
+)
+
+func TestHashAlgorithms(t *testing.T) {
+	// Published test vectors for the raw (unsalted, not JSON encoded) input.
+	testCases := []struct {
+		algorithm string
+		in        string
+		out       uint64
+	}{
+		{algorithm: "sha1", in: "", out: 0xda39a3ee5e6b4b0d},
+		{algorithm: "sha1", in: "abc", out: 0xa9993e364706816a},
+		{algorithm: "murmur3", in: "", out: 0},
+		{algorithm: "murmur3", in: "test", out: 0xba6bd213},
+		{algorithm: "murmur3", in: "Hello, world!", out: 0xc0363e43},
+		{algorithm: "murmur3", in: "The quick brown fox jumps over the lazy dog", out: 0x2e4ff723},
+		{algorithm: "xxhash", in: "", out: 0xef46db3751d8e999},
+		{algorithm: "xxhash", in: "a", out: 0xd24ec4f1a98c6e5b},
+		{algorithm: "xxhash", in: "abc", out: 0x44bc2cf5ad770999},
+		{algorithm: "xxhash", in: "The quick brown fox jumps over the lazy dog", out: 0x0b242d361fda71bc},
+		{algorithm: "fnv", in: "", out: 0xcbf29ce484222325},
+		{algorithm: "fnv", in: "a", out: 0xaf63dc4c8601ec8c},
+		{algorithm: "fnv", in: "foobar", out: 0x85944171f73967e8},
+	}
+
+	for _, test := range testCases {
+		res := hashAlgorithms[test.algorithm].sum([]byte(test.in))
+		if res != test.out {
+			t.Errorf("%s(%q) expected %#x got %#x", test.algorithm, test.in, test.out, res)
+		}
+	}
+}
+
+func TestMurmur3Seed(t *testing.T) {
+	if res := murmur3Sum32([]byte(""), 1); res != 0x514e28b7 {
+		t.Errorf("expected %#x got %#x", 0x514e28b7, res)
+	}
+}
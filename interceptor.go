@@ -0,0 +1,47 @@
+package condition
+
+// Interceptor wraps function handlers. It receives the next handler in the
+// chain and returns a handler that is called instead. Interceptors can run
+// code before and after the call, change its result or skip it entirely.
+type Interceptor func(next ExpressionFunc) ExpressionFunc
+
+// Use adds interceptors that are applied to every function call, including
+// macros. Interceptors added first are outermost, i.e. they are called first
+// and see the results of interceptors added after them.
+func (e *Evaluator) Use(interceptors ...Interceptor) {
+	e.interceptors = append(e.interceptors, interceptors...)
+
+	for name, handler := range e.handlers {
+		e.funcs[name] = e.intercept(handler)
+	}
+}
+
+// setHandler binds handler to name. The handler is wrapped with interceptors
+// once, when it is added or when interceptors are added, rather than on
+// every call.
+func (e *Evaluator) setHandler(name string, handler ExpressionFunc) {
+	if e.handlers == nil {
+		e.handlers = map[string]ExpressionFunc{}
+	}
+	if e.funcs == nil {
+		e.funcs = map[string]ExpressionFunc{}
+	}
+
+	e.handlers[name] = handler
+	e.funcs[name] = e.intercept(handler)
+}
+
+// intercept wraps handler with all interceptors.
+func (e *Evaluator) intercept(handler ExpressionFunc) ExpressionFunc {
+	for i := len(e.interceptors) - 1; i >= 0; i-- {
+		handler = e.interceptors[i](handler)
+	}
+	return handler
+}
+
+// FunctionName returns the name of the function called by a function node.
+// It is meant to be used by interceptors.
+func FunctionName(n *Node) string {
+	name, _ := n.Token.Value.(string)
+	return name
+}
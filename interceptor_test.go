@@ -0,0 +1,133 @@
+package condition
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInterceptors(t *testing.T) {
+	evaluator := NewDefaultEvaluator()
+	if err := evaluator.AddMacro("is_adult", []string{"age"}, mustParse(t, `{"gte": [{"var": "age"}, 18]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := []string{}
+	logger := func(prefix string) Interceptor {
+		return func(next ExpressionFunc) ExpressionFunc {
+			return func(e *Evaluator, n *Node) (interface{}, error) {
+				calls = append(calls, prefix+">"+FunctionName(n))
+				res, err := next(e, n)
+				calls = append(calls, prefix+"<"+FunctionName(n))
+				return res, err
+			}
+		}
+	}
+	evaluator.Use(logger("outer"), logger("inner"))
+
+	root := mustParse(t, `{"and": [{"is_adult": {"context": "age"}}]}`)
+	res, err := evaluator.Evaluate(map[string]interface{}{"age": 30.0}, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != true {
+		t.Errorf("expected true got %v", res)
+	}
+
+	expected := []string{
+		"outer>and", "inner>and",
+		"outer>is_adult", "inner>is_adult",
+		"outer>gte", "inner>gte",
+		"outer>var", "inner>var",
+		"outer>context", "inner>context",
+		"inner<context", "outer<context",
+		"inner<var", "outer<var",
+		"inner<gte", "outer<gte",
+		"inner<is_adult", "outer<is_adult",
+		"inner<and", "outer<and",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected calls\n%v\ngot\n%v", expected, calls)
+	}
+}
+
+func TestInterceptorShortCircuit(t *testing.T) {
+	evaluator := NewDefaultEvaluator()
+
+	// Quota check that rejects calls after a limit.
+	remaining := 3
+	evaluator.Use(func(next ExpressionFunc) ExpressionFunc {
+		return func(e *Evaluator, n *Node) (interface{}, error) {
+			if remaining == 0 {
+				return nil, errors.New("quota exceeded")
+			}
+			remaining--
+			return next(e, n)
+		}
+	})
+
+	// Fault injection for context reads.
+	evaluator.Use(func(next ExpressionFunc) ExpressionFunc {
+		return func(e *Evaluator, n *Node) (interface{}, error) {
+			if FunctionName(n) == "context" {
+				return 42.0, nil
+			}
+			return next(e, n)
+		}
+	})
+
+	res, err := evaluator.Evaluate(nil, mustParse(t, `{"eq": [{"context": "x"}, 42]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != true {
+		t.Errorf("expected injected context value, got %v", res)
+	}
+
+	_, err = evaluator.Evaluate(nil, mustParse(t, `{"not": {"not": true}}`))
+	if err == nil || !strings.Contains(err.Error(), "quota exceeded") {
+		t.Errorf("expected quota error, got %v", err)
+	}
+}
+
+func TestInterceptorChainBuiltOnce(t *testing.T) {
+	evaluator := NewDefaultEvaluator()
+
+	wrapped := map[string]int{}
+	evaluator.Use(func(next ExpressionFunc) ExpressionFunc {
+		return func(e *Evaluator, n *Node) (interface{}, error) {
+			wrapped[FunctionName(n)]++
+			return next(e, n)
+		}
+	})
+
+	built := 0
+	evaluator.Use(func(next ExpressionFunc) ExpressionFunc {
+		built++
+		return next
+	})
+	afterUse := built
+
+	// Handlers added after Use are wrapped too.
+	evaluator.AddHandler("answer", func(e *Evaluator, n *Node) (interface{}, error) {
+		return 42.0, nil
+	})
+	if built != afterUse+1 {
+		t.Errorf("expected new handler to be wrapped once, got %d", built-afterUse)
+	}
+
+	root := mustParse(t, `{"eq": [{"answer": []}, 42]}`)
+	for i := 0; i < 3; i++ {
+		if res, err := evaluator.Evaluate(nil, root); err != nil || res != true {
+			t.Fatalf("expected true got %v, %v", res, err)
+		}
+	}
+
+	if built != afterUse+1 {
+		t.Errorf("expected interceptors not to be applied on calls, got %d", built-afterUse)
+	}
+	if wrapped["answer"] != 3 || wrapped["eq"] != 3 {
+		t.Errorf("unexpected calls %v", wrapped)
+	}
+}
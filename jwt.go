@@ -0,0 +1,260 @@
+package condition
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Supported JWT signature algorithms.
+const (
+	JWTAlgorithmHS256 = "HS256"
+	JWTAlgorithmRS256 = "RS256"
+	JWTAlgorithmES256 = "ES256"
+)
+
+// JWTKey is a key used by the jwt_claims expression to verify token
+// signatures. Tokens signed with a different algorithm than the key's are
+// rejected.
+type JWTKey struct {
+	Algorithm string
+
+	// key is a []byte secret for HS256, *rsa.PublicKey for RS256 and
+	// *ecdsa.PublicKey for ES256.
+	key interface{}
+}
+
+// NewJWTKey creates a verification key for an algorithm. For HS256 material
+// is the shared secret. For RS256 and ES256 it is a PEM encoded public key or
+// certificate.
+func NewJWTKey(algorithm string, material []byte) (*JWTKey, error) {
+	if algorithm == JWTAlgorithmHS256 {
+		if len(material) == 0 {
+			return nil, errors.New("HS256 secret is empty")
+		}
+		return &JWTKey{Algorithm: algorithm, key: material}, nil
+	}
+
+	if algorithm != JWTAlgorithmRS256 && algorithm != JWTAlgorithmES256 {
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", algorithm)
+	}
+
+	block, _ := pem.Decode(material)
+	if block == nil {
+		return nil, errors.New("expected a PEM encoded public key")
+	}
+
+	var publicKey interface{}
+	var err error
+	switch block.Type {
+	case "PUBLIC KEY":
+		publicKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		publicKey, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			publicKey = cert.PublicKey
+		}
+	default:
+		return nil, fmt.Errorf("unexpected PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if algorithm == JWTAlgorithmRS256 {
+			return &JWTKey{Algorithm: algorithm, key: key}, nil
+		}
+	case *ecdsa.PublicKey:
+		if algorithm == JWTAlgorithmES256 && key.Curve == elliptic.P256() {
+			return &JWTKey{Algorithm: algorithm, key: key}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("public key can't be used with %s", algorithm)
+}
+
+// verify checks the signature of signed, the base64url encoded header and
+// payload joined by a dot.
+func (k *JWTKey) verify(signed string, signature []byte) bool {
+	hashed := sha256.Sum256([]byte(signed))
+
+	switch key := k.key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		return hmac.Equal(signature, mac.Sum(nil))
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], signature) == nil
+	case *ecdsa.PublicKey:
+		if len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(key, hashed[:], r, s)
+	}
+
+	return false
+}
+
+// AddJWTKey registers a named key for the jwt_claims expression.
+func (e *Evaluator) AddJWTKey(name string, key *JWTKey) {
+	if e.jwtKeys == nil {
+		e.jwtKeys = map[string]*JWTKey{}
+	}
+	e.jwtKeys[name] = key
+}
+
+// selectJWTKey picks a key by an explicit name, by the token's kid header or,
+// if there is a single key registered, that key.
+func (e *Evaluator) selectJWTKey(name, kid string) (*JWTKey, error) {
+	if name == "" {
+		name = kid
+	}
+
+	if name == "" {
+		if len(e.jwtKeys) == 1 {
+			for _, key := range e.jwtKeys {
+				return key, nil
+			}
+		}
+		return nil, newError(ErrorKindValue, "token has no key id and no key name was given")
+	}
+
+	key, ok := e.jwtKeys[name]
+	if !ok {
+		return nil, newError(ErrorKindValue, "unknown JWT key %q", name)
+	}
+
+	return key, nil
+}
+
+func decodeJWTSegment(segment string) ([]byte, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+	if err != nil {
+		return nil, newError(ErrorKindToken, "malformed token: %s", err.Error())
+	}
+	return data, nil
+}
+
+func decodeJWTObject(segment string) (map[string]interface{}, error) {
+	data, err := decodeJWTSegment(segment)
+	if err != nil {
+		return nil, err
+	}
+
+	var obj map[string]interface{}
+	if err := json.Unmarshal(data, &obj); err != nil || obj == nil {
+		return nil, newError(ErrorKindToken, "malformed token: expected a JSON object")
+	}
+
+	return obj, nil
+}
+
+// JWTClaimsExpressionHandler verifies a JSON Web Token and returns its claims.
+// It takes the token, optionally prefixed with "Bearer ", and an optional name
+// of the key to verify it with. Without a key name the key is picked by the
+// token's kid header. Expired tokens and tokens that are not valid yet are
+// rejected.
+func JWTClaimsExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	args := NewArgs(e, n)
+	res, err := args.Value(0)
+	if err != nil {
+		return nil, err
+	}
+
+	var token string
+	switch v := res.(type) {
+	case nil:
+		return nil, newError(ErrorKindToken, "missing token")
+	case string:
+		token = v
+	default:
+		return nil, newError(ErrorKindType, "expected token as a string, got %s", typeOf(res))
+	}
+
+	if len(token) > 7 && strings.EqualFold(token[:7], "bearer ") {
+		token = strings.TrimSpace(token[7:])
+	}
+
+	keyName := ""
+	if args.Has(1) {
+		if keyName, err = evaluateString(args, 1); err != nil {
+			return nil, err
+		}
+	}
+
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return nil, newError(ErrorKindToken, "malformed token: expected 3 segments, got %d", len(segments))
+	}
+
+	header, err := decodeJWTObject(segments[0])
+	if err != nil {
+		return nil, err
+	}
+
+	alg, _ := header["alg"].(string)
+	kid, _ := header["kid"].(string)
+
+	key, err := e.selectJWTKey(keyName, kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if alg != key.Algorithm {
+		return nil, newError(ErrorKindToken, "token algorithm %q doesn't match key algorithm %q", alg, key.Algorithm)
+	}
+
+	signature, err := decodeJWTSegment(segments[2])
+	if err != nil {
+		return nil, err
+	}
+
+	if !key.verify(segments[0]+"."+segments[1], signature) {
+		return nil, newError(ErrorKindToken, "invalid token signature")
+	}
+
+	claims, err := decodeJWTObject(segments[1])
+	if err != nil {
+		return nil, err
+	}
+
+	now := float64(e.currentTime().UnixNano()) / 1e9
+	if exp, ok := claims["exp"]; ok {
+		expFloat, ok := exp.(float64)
+		if !ok {
+			return nil, newError(ErrorKindToken, "expected exp claim to be a number")
+		}
+		if now >= expFloat {
+			return nil, newError(ErrorKindToken, "token has expired")
+		}
+	}
+
+	if nbf, ok := claims["nbf"]; ok {
+		nbfFloat, ok := nbf.(float64)
+		if !ok {
+			return nil, newError(ErrorKindToken, "expected nbf claim to be a number")
+		}
+		if now < nbfFloat {
+			return nil, newError(ErrorKindToken, "token is not valid yet")
+		}
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,251 @@
+package condition
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+	"time"
+)
+
+func encodeJWT(t *testing.T, header, claims map[string]interface{}, sign func(signed []byte) []byte) string {
+	headerData, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claimsData, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(headerData) + "." + base64.RawURLEncoding.EncodeToString(claimsData)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func publicKeyPEM(t *testing.T, key interface{}) []byte {
+	data, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: data})
+}
+
+func TestJWTClaims(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	nowUnix := float64(now.Unix())
+
+	secret := []byte("gateway-secret")
+	signHS256 := func(signed []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		return mac.Sum(nil)
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signRS256 := func(signed []byte) []byte {
+		hashed := sha256.Sum256(signed)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, hashed[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signES256 := func(signed []byte) []byte {
+		hashed := sha256.Sum256(signed)
+		r, s, err := ecdsa.Sign(rand.Reader, ecKey, hashed[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig
+	}
+
+	hsKey, err := NewJWTKey(JWTAlgorithmHS256, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsKey, err := NewJWTKey(JWTAlgorithmRS256, publicKeyPEM(t, &rsaKey.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	esKey, err := NewJWTKey(JWTAlgorithmES256, publicKeyPEM(t, &ecKey.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evaluator := NewDefaultEvaluator()
+	evaluator.SetClock(func() time.Time { return now })
+	evaluator.AddJWTKey("gateway", hsKey)
+	evaluator.AddJWTKey("idp", rsKey)
+	evaluator.AddJWTKey("mobile", esKey)
+
+	claims := map[string]interface{}{
+		"sub":   "user-1",
+		"roles": []interface{}{"admin"},
+		"exp":   nowUnix + 60,
+		"nbf":   nowUnix - 60,
+	}
+
+	tokens := map[string]interface{}{
+		"hs256":         encodeJWT(t, map[string]interface{}{"alg": "HS256", "kid": "gateway"}, claims, signHS256),
+		"rs256":         encodeJWT(t, map[string]interface{}{"alg": "RS256", "kid": "idp"}, claims, signRS256),
+		"es256":         encodeJWT(t, map[string]interface{}{"alg": "ES256", "kid": "mobile"}, claims, signES256),
+		"no_kid":        encodeJWT(t, map[string]interface{}{"alg": "RS256"}, claims, signRS256),
+		"no_exp":        encodeJWT(t, map[string]interface{}{"alg": "HS256", "kid": "gateway"}, map[string]interface{}{"sub": "user-2"}, signHS256),
+		"expired":       encodeJWT(t, map[string]interface{}{"alg": "HS256", "kid": "gateway"}, map[string]interface{}{"exp": nowUnix}, signHS256),
+		"not_yet_valid": encodeJWT(t, map[string]interface{}{"alg": "HS256", "kid": "gateway"}, map[string]interface{}{"nbf": nowUnix + 1}, signHS256),
+		"bad_exp":       encodeJWT(t, map[string]interface{}{"alg": "HS256", "kid": "gateway"}, map[string]interface{}{"exp": "tomorrow"}, signHS256),
+		"wrong_alg":     encodeJWT(t, map[string]interface{}{"alg": "HS256", "kid": "idp"}, claims, signHS256),
+		"none":          encodeJWT(t, map[string]interface{}{"alg": "none", "kid": "gateway"}, claims, func([]byte) []byte { return nil }),
+		"unknown_kid":   encodeJWT(t, map[string]interface{}{"alg": "HS256", "kid": "other"}, claims, signHS256),
+		"malformed":     "not-a-token",
+		"number":        1.0,
+	}
+	tokens["bearer"] = "Bearer " + tokens["hs256"].(string)
+	tokens["tampered"] = tokens["hs256"].(string)[:len(tokens["hs256"].(string))-2] + "AA"
+	ctx := map[string]interface{}{"tokens": tokens}
+
+	testCases := []struct {
+		in  string
+		out interface{}
+	}{
+		{in: `{"get": [{"jwt_claims": {"context": ["tokens", "hs256"]}}, ["sub"]]}`, out: "user-1"},
+		{in: `{"get": [{"jwt_claims": {"context": ["tokens", "rs256"]}}, ["sub"]]}`, out: "user-1"},
+		{in: `{"get": [{"jwt_claims": {"context": ["tokens", "es256"]}}, ["sub"]]}`, out: "user-1"},
+		{in: `{"get": [{"jwt_claims": {"context": ["tokens", "bearer"]}}, ["roles", 0]]}`, out: "admin"},
+		{in: `{"get": [{"jwt_claims": [{"context": ["tokens", "no_kid"]}, "idp"]}, ["sub"]]}`, out: "user-1"},
+		{in: `{"get": [{"jwt_claims": {"context": ["tokens", "no_exp"]}}, "sub"]}`, out: "user-2"},
+		{in: `{"try": [{"jwt_claims": {"context": ["tokens", "expired"]}}, "denied", "token"]}`, out: "denied"},
+		{in: `{"try": [{"jwt_claims": {"context": ["tokens", "missing"]}}, "denied", "token"]}`, out: "denied"},
+	}
+
+	for _, test := range testCases {
+		root, err := Parse(test.in)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test.in, err.Error())
+		} else {
+			res, err := evaluator.Evaluate(ctx, root)
+			if err != nil {
+				t.Errorf("%q got an error: %s", test.in, err.Error())
+			} else if res != test.out {
+				t.Errorf("%q expected %v got %v", test.in, test.out, res)
+			}
+		}
+	}
+
+	errorCases := []struct {
+		token string
+		kind  ErrorKind
+	}{
+		{token: "expired", kind: ErrorKindToken},
+		{token: "not_yet_valid", kind: ErrorKindToken},
+		{token: "bad_exp", kind: ErrorKindToken},
+		{token: "wrong_alg", kind: ErrorKindToken},
+		{token: "none", kind: ErrorKindToken},
+		{token: "tampered", kind: ErrorKindToken},
+		{token: "malformed", kind: ErrorKindToken},
+		{token: "missing", kind: ErrorKindToken},
+		{token: "no_kid", kind: ErrorKindValue},
+		{token: "unknown_kid", kind: ErrorKindValue},
+		{token: "number", kind: ErrorKindType},
+	}
+
+	for _, test := range errorCases {
+		in := `{"jwt_claims": {"context": ["tokens", "` + test.token + `"]}}`
+		root, err := Parse(in)
+		if err != nil {
+			t.Errorf("%q got an error: %s", in, err.Error())
+		} else if _, err := evaluator.Evaluate(ctx, root); err == nil {
+			t.Errorf("%q expected an error", in)
+		} else if kind := ErrorKindOf(err); kind != test.kind {
+			t.Errorf("%q expected %q error got %q: %s", in, test.kind, kind, err.Error())
+		}
+	}
+
+	// With a single key registered the kid header is optional.
+	single := NewDefaultEvaluator()
+	single.SetClock(func() time.Time { return now })
+	single.AddJWTKey("idp", rsKey)
+	root, err := Parse(`{"jwt_claims": {"context": ["tokens", "no_kid"]}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := single.Evaluate(ctx, root); err != nil {
+		t.Errorf("expected token to be verified with the only key, got an error: %s", err.Error())
+	}
+}
+
+func TestAddJWTKeyZeroEvaluator(t *testing.T) {
+	key, err := NewJWTKey(JWTAlgorithmHS256, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := &Evaluator{}
+	e.AddJWTKey("gateway", key)
+	if e.jwtKeys["gateway"] != key {
+		t.Errorf("expected key to be registered")
+	}
+}
+
+func TestNewJWTKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkcs1 := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)})
+
+	testCases := []struct {
+		algorithm string
+		material  []byte
+		valid     bool
+	}{
+		{algorithm: "HS256", material: []byte("secret"), valid: true},
+		{algorithm: "HS256", material: nil, valid: false},
+		{algorithm: "RS256", material: publicKeyPEM(t, &rsaKey.PublicKey), valid: true},
+		{algorithm: "RS256", material: pkcs1, valid: true},
+		{algorithm: "RS256", material: publicKeyPEM(t, &ecKey.PublicKey), valid: false},
+		{algorithm: "RS256", material: []byte("not pem"), valid: false},
+		{algorithm: "ES256", material: publicKeyPEM(t, &ecKey.PublicKey), valid: true},
+		{algorithm: "ES256", material: publicKeyPEM(t, &ec384Key.PublicKey), valid: false},
+		{algorithm: "ES256", material: publicKeyPEM(t, &rsaKey.PublicKey), valid: false},
+		{algorithm: "none", material: []byte("secret"), valid: false},
+	}
+
+	for i, test := range testCases {
+		_, err := NewJWTKey(test.algorithm, test.material)
+		if test.valid && err != nil {
+			t.Errorf("case %d: %s key got an error: %s", i, test.algorithm, err.Error())
+		} else if !test.valid && err == nil {
+			t.Errorf("case %d: %s key expected an error", i, test.algorithm)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package condition
+
+import (
+	"fmt"
+)
+
+// macro is a named, parameterised expression registered on an Evaluator.
+type macro struct {
+	params []string
+	body   *Node
+}
+
+// AddMacro registers a user defined function. The macro is called like any
+// other expression and its arguments are bound to params, which are
+// accessible in body through the var expression. Arguments are evaluated
+// lazily, at most once, in the scope of the caller. The body does not see
+// variables bound at the call site.
+//
+// Macros may call other macros, but AddMacro returns an error if the new
+// macro would make a macro call itself directly or indirectly.
+func (e *Evaluator) AddMacro(name string, params []string, body *Node) error {
+	if body == nil {
+		return fmt.Errorf("macro %q has no body", name)
+	}
+
+	seen := map[string]bool{}
+	for _, param := range params {
+		if seen[param] {
+			return fmt.Errorf("macro %q has duplicate parameter %q", name, param)
+		}
+		seen[param] = true
+	}
+
+	if e.macros == nil {
+		e.macros = map[string]*macro{}
+	}
+
+	m := &macro{
+		params: params,
+		body:   body,
+	}
+
+	previous, hadPrevious := e.macros[name]
+	e.macros[name] = m
+	if cycle := e.findMacroCycle(name, []string{name}); cycle != nil {
+		if hadPrevious {
+			e.macros[name] = previous
+		} else {
+			delete(e.macros, name)
+		}
+		return fmt.Errorf("macro %q is recursive: %v", name, cycle)
+	}
+
+	e.setHandler(name, newExpression(name, func(e *Evaluator, n *Node) (interface{}, error) {
+		return e.callMacro(m, n)
+	}))
+
+	return nil
+}
+
+// findMacroCycle returns a call path leading back to a macro on path or nil if
+// there is none.
+func (e *Evaluator) findMacroCycle(name string, path []string) []string {
+	for _, callee := range calledFunctions(e.macros[name].body) {
+		if _, ok := e.macros[callee]; !ok {
+			continue
+		}
+
+		calleePath := append(append([]string{}, path...), callee)
+		for _, visited := range path {
+			if visited == callee {
+				return calleePath
+			}
+		}
+
+		if cycle := e.findMacroCycle(callee, calleePath); cycle != nil {
+			return cycle
+		}
+	}
+
+	return nil
+}
+
+// calledFunctions returns names of all functions referenced in the tree.
+func calledFunctions(n *Node) []string {
+	names := []string{}
+	if n.Type == NodeTypeFunction {
+		names = append(names, n.Token.Value.(string))
+	}
+
+	for _, child := range n.Children {
+		names = append(names, calledFunctions(child)...)
+	}
+
+	return names
+}
+
+func (e *Evaluator) callMacro(m *macro, n *Node) (interface{}, error) {
+	args := functionArgs(n)
+	if len(args) != len(m.params) {
+		return nil, newError(ErrorKindArity, errExpectedNArguments, len(m.params), len(args))
+	}
+
+	var bodyScope *scope
+	for i, param := range m.params {
+		bodyScope = &scope{
+			parent: bodyScope,
+			name:   param,
+			binding: &binding{
+				node:  args[i],
+				scope: e.scope,
+			},
+		}
+	}
+
+	callerScope := e.scope
+	e.scope = bodyScope
+	res, err := e.evaluateNode(m.body)
+	e.scope = callerScope
+
+	return res, err
+}
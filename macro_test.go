@@ -0,0 +1,167 @@
+package condition
+
+import (
+	"testing"
+)
+
+func mustParse(t *testing.T, expression string) *Node {
+	t.Helper()
+	root, err := Parse(expression)
+	if err != nil {
+		t.Fatalf("%q got an error: %s", expression, err.Error())
+	}
+	return root
+}
+
+func TestMacro(t *testing.T) {
+	calls := 0
+	evaluator := NewDefaultEvaluator()
+	evaluator.AddHandler("count", func(e *Evaluator, n *Node) (interface{}, error) {
+		calls++
+		return float64(calls), nil
+	})
+
+	macros := []struct {
+		name   string
+		params []string
+		body   string
+	}{
+		{
+			name:   "is_internal_user",
+			params: []string{},
+			body:   `{"eq": [{"context": ["domain"]}, "example.com"]}`,
+		},
+		{
+			name:   "between",
+			params: []string{"value", "min", "max"},
+			body:   `{"and": [{"gte": [{"var": "value"}, {"var": "min"}]}, {"lt": [{"var": "value"}, {"var": "max"}]}]}`,
+		},
+		{
+			name:   "in_rollout",
+			params: []string{"percent"},
+			body:   `{"or": [{"is_internal_user": []}, {"between": [{"sha1mod": [{"context": ["user_id"]}, 100]}, 0, {"var": "percent"}]}]}`,
+		},
+		{
+			name:   "twice",
+			params: []string{"x"},
+			body:   `{"eq": [{"var": "x"}, {"var": "x"}]}`,
+		},
+	}
+
+	for _, m := range macros {
+		if err := evaluator.AddMacro(m.name, m.params, mustParse(t, m.body)); err != nil {
+			t.Fatalf("%s got an error: %s", m.name, err.Error())
+		}
+	}
+
+	testCases := []struct {
+		in    string
+		ctx   string
+		out   interface{}
+		calls int
+	}{
+		{
+			in:  `{"is_internal_user": []}`,
+			ctx: `{"domain": "example.com"}`,
+			out: true,
+		},
+		{
+			in:  `{"between": [5, 0, 10]}`,
+			ctx: `{}`,
+			out: true,
+		},
+		{
+			in:  `{"between": [10, 0, 10]}`,
+			ctx: `{}`,
+			out: false,
+		},
+		{
+			in:  `{"in_rollout": [100]}`,
+			ctx: `{"domain": "other.com", "user_id": 1}`,
+			out: true,
+		},
+		{
+			in:  `{"in_rollout": [0]}`,
+			ctx: `{"domain": "example.com", "user_id": 1}`,
+			out: true,
+		},
+		{
+			in:  `{"in_rollout": [0]}`,
+			ctx: `{"domain": "other.com", "user_id": 1}`,
+			out: false,
+		},
+		{
+			in:  `{"let": [{"min": 100}, {"between": [{"var": "min"}, 0, 200]}]}`,
+			ctx: `{}`,
+			out: true,
+		},
+		{
+			in:    `{"twice": {"count": []}}`,
+			ctx:   `{}`,
+			out:   true,
+			calls: 1,
+		},
+	}
+
+	for _, test := range testCases {
+		calls = 0
+		res, err := evaluator.Evaluate(test.ctx, mustParse(t, test.in))
+		if err != nil {
+			t.Errorf("%q got an error: %s", test.in, err.Error())
+		} else {
+			if res != test.out {
+				t.Errorf("%q expected %v got %v", test.in, test.out, res)
+			}
+			if calls != test.calls {
+				t.Errorf("%q expected %d evaluations got %d", test.in, test.calls, calls)
+			}
+		}
+	}
+
+	errorCases := []string{
+		`{"between": [1, 2]}`,
+		`{"let": [{"value": 1}, {"is_internal_user_var": []}]}`,
+	}
+	evaluator.AddMacro("is_internal_user_var", nil, mustParse(t, `{"var": "value"}`))
+
+	for _, test := range errorCases {
+		if _, err := evaluator.Evaluate(`{}`, mustParse(t, test)); err == nil {
+			t.Errorf("%q expected an error", test)
+		}
+	}
+}
+
+func TestMacroCycles(t *testing.T) {
+	evaluator := NewDefaultEvaluator()
+
+	if err := evaluator.AddMacro("a", nil, mustParse(t, `{"not": {"a": []}}`)); err == nil {
+		t.Errorf("expected an error for directly recursive macro")
+	}
+
+	if err := evaluator.AddMacro("b", nil, mustParse(t, `{"not": {"c": []}}`)); err != nil {
+		t.Errorf("got an error: %s", err.Error())
+	}
+
+	if err := evaluator.AddMacro("c", nil, mustParse(t, `{"d": []}`)); err != nil {
+		t.Errorf("got an error: %s", err.Error())
+	}
+
+	if err := evaluator.AddMacro("d", nil, mustParse(t, `{"b": []}`)); err == nil {
+		t.Errorf("expected an error for indirectly recursive macro")
+	}
+
+	if err := evaluator.AddMacro("d", nil, mustParse(t, `true`)); err != nil {
+		t.Errorf("got an error: %s", err.Error())
+	}
+
+	res, err := evaluator.Evaluate(nil, mustParse(t, `{"b": []}`))
+	if err != nil {
+		t.Errorf("got an error: %s", err.Error())
+	} else if res != false {
+		t.Errorf("expected false got %v", res)
+	}
+
+	if err := evaluator.AddMacro("e", []string{"x", "x"}, mustParse(t, `true`)); err == nil {
+		t.Errorf("expected an error for duplicate parameters")
+	}
+}
@@ -0,0 +1,267 @@
+package condition
+
+import (
+	"sort"
+)
+
+// evaluateObject evaluates the argument at index i and checks that it returned
+// an object.
+func evaluateObject(args *Args, i int) (map[string]interface{}, error) {
+	res, err := args.Value(i)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, ok := res.(map[string]interface{})
+	if !ok {
+		return nil, newError(ErrorKindType, "expected object, got %s", typeOf(res))
+	}
+
+	return obj, nil
+}
+
+// evaluateKeys evaluates the argument at index i to a list of object keys. A
+// single string is treated as a list of one key.
+func evaluateKeys(args *Args, i int) ([]string, error) {
+	res, err := args.Value(i)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := res.(type) {
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		keys := make([]string, len(v))
+		for i, key := range v {
+			asString, ok := key.(string)
+			if !ok {
+				return nil, newError(ErrorKindType, "expected object key as a string, got %s", typeOf(key))
+			}
+			keys[i] = asString
+		}
+		return keys, nil
+	}
+
+	return nil, newError(ErrorKindType, "expected a key or a list of keys, got %s", typeOf(res))
+}
+
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// objectArg evaluates the only argument of n, which must be an object.
+func objectArg(e *Evaluator, n *Node) (map[string]interface{}, error) {
+	return evaluateObject(NewArgs(e, n), 0)
+}
+
+// ObjectExpressionHandler builds an object from [key, value] pairs passed in
+// as arguments or from a single argument that evaluates to a list of pairs,
+// e.g. the result of entries. Later pairs override earlier ones with the same
+// key.
+func ObjectExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	pairs := []interface{}{}
+	args := NewArgs(e, n)
+	for i := 0; i < args.Len(); i++ {
+		res, err := args.Value(i)
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, res)
+	}
+
+	if len(pairs) == 1 && isListOfLists(pairs[0]) {
+		pairs = pairs[0].([]interface{})
+	}
+
+	obj := map[string]interface{}{}
+	for _, res := range pairs {
+		pair, ok := res.([]interface{})
+		if !ok || len(pair) != 2 {
+			return nil, newError(ErrorKindType, "expected [key, value] pair, got %s", typeOf(res))
+		}
+
+		key, ok := pair[0].(string)
+		if !ok {
+			return nil, newError(ErrorKindType, "expected object key as a string, got %s", typeOf(pair[0]))
+		}
+
+		obj[key] = pair[1]
+	}
+
+	return obj, nil
+}
+
+func isListOfLists(v interface{}) bool {
+	list, ok := v.([]interface{})
+	if !ok {
+		return false
+	}
+
+	for _, item := range list {
+		if _, ok := item.([]interface{}); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// KeysExpressionHandler returns sorted keys of an object.
+func KeysExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	obj, err := objectArg(e, n)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []interface{}{}
+	for _, key := range sortedKeys(obj) {
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// ValuesExpressionHandler returns values of an object ordered by their keys.
+func ValuesExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	obj, err := objectArg(e, n)
+	if err != nil {
+		return nil, err
+	}
+
+	values := []interface{}{}
+	for _, key := range sortedKeys(obj) {
+		values = append(values, obj[key])
+	}
+
+	return values, nil
+}
+
+// EntriesExpressionHandler returns [key, value] pairs of an object ordered by
+// their keys.
+func EntriesExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	obj, err := objectArg(e, n)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []interface{}{}
+	for _, key := range sortedKeys(obj) {
+		entries = append(entries, []interface{}{key, obj[key]})
+	}
+
+	return entries, nil
+}
+
+// HasKeyExpressionHandler returns true if the object passed in as the first
+// argument has the key passed in as the second argument.
+func HasKeyExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	args := NewArgs(e, n)
+	obj, err := evaluateObject(args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := args.Value(1)
+	if err != nil {
+		return nil, err
+	}
+
+	keyString, ok := key.(string)
+	if !ok {
+		return nil, newError(ErrorKindType, "expected object key as a string, got %s", typeOf(key))
+	}
+
+	_, ok = obj[keyString]
+	return ok, nil
+}
+
+// MergeExpressionHandler returns a shallow merge of its arguments. Keys of
+// later objects override keys of earlier ones. Null arguments are skipped.
+func MergeExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	merged := map[string]interface{}{}
+
+	args := NewArgs(e, n)
+	for i := 0; i < args.Len(); i++ {
+		res, err := args.Value(i)
+		if err != nil {
+			return nil, err
+		}
+
+		if res == nil {
+			continue
+		}
+
+		obj, ok := res.(map[string]interface{})
+		if !ok {
+			return nil, newError(ErrorKindType, "expected object, got %s", typeOf(res))
+		}
+
+		for key, value := range obj {
+			merged[key] = value
+		}
+	}
+
+	return merged, nil
+}
+
+// PickExpressionHandler returns a copy of an object with only the given keys.
+// Keys are passed in as the second argument, either a single key or a list.
+func PickExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	obj, keys, err := objectAndKeys(e, n)
+	if err != nil {
+		return nil, err
+	}
+
+	picked := map[string]interface{}{}
+	for _, key := range keys {
+		if value, ok := obj[key]; ok {
+			picked[key] = value
+		}
+	}
+
+	return picked, nil
+}
+
+// OmitExpressionHandler returns a copy of an object without the given keys.
+// Keys are passed in as the second argument, either a single key or a list.
+func OmitExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	obj, keys, err := objectAndKeys(e, n)
+	if err != nil {
+		return nil, err
+	}
+
+	omitted := map[string]bool{}
+	for _, key := range keys {
+		omitted[key] = true
+	}
+
+	res := map[string]interface{}{}
+	for key, value := range obj {
+		if !omitted[key] {
+			res[key] = value
+		}
+	}
+
+	return res, nil
+}
+
+func objectAndKeys(e *Evaluator, n *Node) (map[string]interface{}, []string, error) {
+	args := NewArgs(e, n)
+	obj, err := evaluateObject(args, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys, err := evaluateKeys(args, 1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return obj, keys, nil
+}
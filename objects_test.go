@@ -0,0 +1,74 @@
+package condition
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestObjectExpressions(t *testing.T) {
+	context := `{
+			"overrides": {"b": 2, "a": 1, "c": null},
+			"defaults": {"a": 0, "d": 4},
+			"list": [1, 2]
+		}`
+	evaluator := NewDefaultEvaluator()
+
+	testCases := []struct {
+		in  string
+		out interface{}
+	}{
+		{in: `{"object": []}`, out: map[string]interface{}{}},
+		{in: `{"object": [["a", 1], ["b", {"context": "list"}], ["a", 2]]}`, out: map[string]interface{}{"a": float64(2), "b": []interface{}{float64(1), float64(2)}}},
+		{in: `{"object": {"entries": {"context": "defaults"}}}`, out: map[string]interface{}{"a": float64(0), "d": float64(4)}},
+		{in: `{"keys": {"context": "overrides"}}`, out: []interface{}{"a", "b", "c"}},
+		{in: `{"keys": {"object": []}}`, out: []interface{}{}},
+		{in: `{"values": {"context": "overrides"}}`, out: []interface{}{float64(1), float64(2), nil}},
+		{in: `{"entries": {"context": "defaults"}}`, out: []interface{}{[]interface{}{"a", float64(0)}, []interface{}{"d", float64(4)}}},
+		{in: `{"has_key": [{"context": "overrides"}, "c"]}`, out: true},
+		{in: `{"has_key": [{"context": "overrides"}, "d"]}`, out: false},
+		{in: `{"merge": []}`, out: map[string]interface{}{}},
+		{in: `{"merge": [{"context": "defaults"}, null, {"context": "overrides"}]}`, out: map[string]interface{}{"a": float64(1), "b": float64(2), "c": nil, "d": float64(4)}},
+		{in: `{"merge": [{"context": "overrides"}, {"context": "defaults"}]}`, out: map[string]interface{}{"a": float64(0), "b": float64(2), "c": nil, "d": float64(4)}},
+		{in: `{"pick": [{"context": "overrides"}, ["a", "c", "x"]]}`, out: map[string]interface{}{"a": float64(1), "c": nil}},
+		{in: `{"pick": [{"context": "overrides"}, "b"]}`, out: map[string]interface{}{"b": float64(2)}},
+		{in: `{"omit": [{"context": "overrides"}, ["a", "x"]]}`, out: map[string]interface{}{"b": float64(2), "c": nil}},
+		{in: `{"omit": [{"context": "overrides"}, "c"]}`, out: map[string]interface{}{"a": float64(1), "b": float64(2)}},
+		{in: `{"get": [{"merge": [{"context": "defaults"}, {"object": [["d", 5]]}]}, "d"]}`, out: float64(5)},
+	}
+
+	for _, test := range testCases {
+		root, err := Parse(test.in)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test.in, err.Error())
+		} else {
+			res, err := evaluator.Evaluate(context, root)
+			if err != nil {
+				t.Errorf("%q got an error: %s", test.in, err.Error())
+			} else if !reflect.DeepEqual(res, test.out) {
+				t.Errorf("%q expected %v got %v", test.in, test.out, res)
+			}
+		}
+	}
+
+	errorCases := []string{
+		`{"object": [["a"]]}`,
+		`{"object": [[1, 2]]}`,
+		`{"keys": {"context": "list"}}`,
+		`{"keys": []}`,
+		`{"values": [{"context": "defaults"}, 1]}`,
+		`{"has_key": [{"context": "defaults"}, 1]}`,
+		`{"merge": [{"context": "defaults"}, 1]}`,
+		`{"pick": [{"context": "defaults"}, [1]]}`,
+		`{"omit": [{"context": "list"}, "a"]}`,
+		`{"omit": [{"context": "defaults"}]}`,
+	}
+
+	for _, test := range errorCases {
+		root, err := Parse(test)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test, err.Error())
+		} else if _, err := evaluator.Evaluate(context, root); err == nil {
+			t.Errorf("%q expected an error", test)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package condition
+
+import (
+	"errors"
+)
+
+// errImpure is returned by the fold interceptor for calls to functions that
+// can't be evaluated ahead of time.
+var errImpure = errors.New("impure function")
+
+// Optimize simplifies a condition that uses functions from DefaultRegistry.
+// See Registry.Optimize.
+func Optimize(root *Node) *Node {
+	return DefaultRegistry.Optimize(root)
+}
+
+// Optimize returns a simplified copy of root, which calls functions from the
+// registry by their registered names. The result evaluates to the same value
+// and fails in the same cases as root, in both strict and non-strict mode.
+//
+// Calls that evaluate without calling impure functions are replaced by their
+// values. Nested and and or are flattened, their known operands and repeated
+// operands are removed, and if and cond with known predicates are replaced by
+// the selected branch. The and, or, not, if and cond functions in the
+// registry are assumed to be the built-in ones. Functions missing from the
+// registry, e.g. macros, are left as they are.
+func (r *Registry) Optimize(root *Node) *Node {
+	o := &optimizer{
+		registry:  r,
+		evaluator: r.NewEvaluator(),
+	}
+
+	// Folded values must not depend on evaluation options. Predicates that
+	// are booleans evaluate the same way with any options, other values fail
+	// in strict mode.
+	o.evaluator.SetOptions(Options{Strict: true})
+	o.evaluator.Use(o.pureOnly)
+
+	return o.optimizeNode(root, nil)
+}
+
+type optimizer struct {
+	registry  *Registry
+	evaluator *Evaluator
+
+	// impure is set when a fold calls an impure function.
+	impure bool
+}
+
+// pureOnly is an interceptor that fails calls of impure functions. var is
+// allowed, folded expressions are evaluated without enclosing variables, so
+// it can only read variables bound within them.
+func (o *optimizer) pureOnly(next ExpressionFunc) ExpressionFunc {
+	return func(e *Evaluator, n *Node) (interface{}, error) {
+		name := FunctionName(n)
+		if spec, ok := o.registry.Lookup(name); (!ok || !spec.Pure) && name != "var" {
+			o.impure = true
+			return nil, errImpure
+		}
+		return next(e, n)
+	}
+}
+
+// fold evaluates n. The second return value is false if n can't be replaced
+// by its value.
+func (o *optimizer) fold(n *Node) (interface{}, bool) {
+	o.impure = false
+	val, err := o.evaluator.Evaluate(nil, n)
+	return val, err == nil && !o.impure
+}
+
+// has returns true if name is a function in the registry.
+func (o *optimizer) has(name string) bool {
+	_, ok := o.registry.Lookup(name)
+	return ok
+}
+
+// returnsBoolean returns true if n is a call of a function that always
+// returns a boolean, or a boolean literal.
+func (o *optimizer) returnsBoolean(n *Node) bool {
+	if isBoolLiteral(n) {
+		return true
+	}
+
+	if n.Type != NodeTypeFunction {
+		return false
+	}
+
+	spec, ok := o.registry.Lookup(FunctionName(n))
+	return ok && spec.Returns == TypeBoolean
+}
+
+func isBoolLiteral(n *Node) bool {
+	_, ok := n.Token.Value.(bool)
+	return n.Type == NodeTypeLiteral && ok
+}
+
+// optimizeNode returns the optimized copy of n as a child of parent.
+func (o *optimizer) optimizeNode(n *Node, parent *Node) *Node {
+	switch n.Type {
+	case NodeTypeLiteral:
+		return newLiteralNode(parent, n.Token)
+	case NodeTypeArray:
+		c := newArrayNode(parent)
+		for _, child := range n.Children {
+			c.appendChild(o.optimizeNode(child, c))
+		}
+		return c
+	}
+
+	name := FunctionName(n)
+	c := &Node{
+		Type:   n.Type,
+		Token:  n.Token,
+		Parent: parent,
+	}
+
+	switch name {
+	case "var":
+		// var requires a literal name.
+		c = n.Clone()
+		c.Parent = parent
+		return c
+	case "let":
+		for _, child := range n.Children {
+			c.appendChild(o.optimizeLet(child, c))
+		}
+	default:
+		for _, child := range n.Children {
+			c.appendChild(o.optimizeNode(child, c))
+		}
+	}
+
+	// Handlers such as and, cond and functions taking a single argument
+	// treat array nodes differently from other arguments, so functions are
+	// only replaced by arrays at the root.
+	if val, ok := o.fold(c); ok {
+		if node, ok := valueNode(val, parent); ok && (node.Type != NodeTypeArray || parent == nil) {
+			return node
+		}
+	}
+
+	if !o.has(name) {
+		return c
+	}
+
+	switch name {
+	case "and":
+		return o.optimizeJunction(c, parent, false)
+	case "or":
+		return o.optimizeJunction(c, parent, true)
+	case "not":
+		return o.optimizeNot(c, parent)
+	case "if":
+		return o.optimizeIf(c, parent)
+	case "cond":
+		return o.optimizeCond(c, parent)
+	}
+
+	return c
+}
+
+// optimizeLet optimizes let arguments. Variable bindings are objects, which
+// must not be optimized as function calls.
+func (o *optimizer) optimizeLet(params *Node, parent *Node) *Node {
+	if params.Type != NodeTypeArray {
+		return o.optimizeNode(params, parent)
+	}
+
+	c := newArrayNode(parent)
+	for i, param := range params.Children {
+		if i == len(params.Children)-1 || param.Type != NodeTypeFunction {
+			c.appendChild(o.optimizeNode(param, c))
+			continue
+		}
+
+		binding := &Node{
+			Type:   param.Type,
+			Token:  param.Token,
+			Parent: c,
+		}
+		for _, child := range param.Children {
+			binding.appendChild(o.optimizeNode(child, binding))
+		}
+		c.appendChild(binding)
+	}
+
+	return c
+}
+
+// optimizeJunction simplifies and and or. Nested calls of the same function
+// are flattened, operands that can't change the result are removed and
+// operands after a decisive literal are dropped because they are never
+// evaluated. An operand equal to an earlier one is removed too, evaluating it
+// again gives the same value.
+func (o *optimizer) optimizeJunction(n *Node, parent *Node, decisive bool) *Node {
+	if len(n.Children) != 1 || n.Children[0].Type != NodeTypeArray {
+		return n
+	}
+
+	name := FunctionName(n)
+	candidates := []*Node{}
+	for _, operand := range n.Children[0].Children {
+		if FunctionName(operand) == name && len(operand.Children) == 1 && operand.Children[0].Type == NodeTypeArray {
+			candidates = append(candidates, operand.Children[0].Children...)
+		} else {
+			candidates = append(candidates, operand)
+		}
+	}
+
+	operands := newArrayNode(n)
+	for _, operand := range candidates {
+		if isBoolLiteral(operand) && operand.Token.Value.(bool) != decisive {
+			continue
+		}
+
+		duplicate := false
+		for _, previous := range operands.Children {
+			if previous.Equal(operand) {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			continue
+		}
+
+		operand.Parent = operands
+		operands.appendChild(operand)
+
+		if isBoolLiteral(operand) {
+			break
+		}
+	}
+
+	if len(operands.Children) == 0 {
+		return valueNodeOf(!decisive, parent)
+	}
+
+	if len(operands.Children) == 1 && o.returnsBoolean(operands.Children[0]) {
+		operand := operands.Children[0]
+		operand.Parent = parent
+		return operand
+	}
+
+	n.Children = []*Node{operands}
+	return n
+}
+
+// optimizeNot replaces double negation of a boolean with the boolean. not
+// negates its child as it is, so {"not": [x]} negates the array [x] and is
+// left alone.
+func (o *optimizer) optimizeNot(n *Node, parent *Node) *Node {
+	if len(n.Children) != 1 || n.Children[0].Type != NodeTypeFunction || FunctionName(n.Children[0]) != "not" {
+		return n
+	}
+
+	inner := n.Children[0].Children
+	if len(inner) != 1 || inner[0].Type == NodeTypeArray || !o.returnsBoolean(inner[0]) {
+		return n
+	}
+
+	inner[0].Parent = parent
+	return inner[0]
+}
+
+// optimizeIf replaces if with a boolean literal predicate with the selected
+// branch.
+func (o *optimizer) optimizeIf(n *Node, parent *Node) *Node {
+	params := functionArgs(n)
+	if (len(params) != 2 && len(params) != 3) || !isBoolLiteral(params[0]) {
+		return n
+	}
+
+	branch := valueNodeOf(nil, parent)
+	if params[0].Token.Value.(bool) {
+		branch = params[1]
+	} else if len(params) == 3 {
+		branch = params[2]
+	}
+
+	if branch.Type == NodeTypeArray && parent != nil {
+		return n
+	}
+
+	branch.Parent = parent
+	return branch
+}
+
+// optimizeCond removes pairs with false literal predicates and replaces the
+// default with the value of the first pair with a true literal predicate.
+func (o *optimizer) optimizeCond(n *Node, parent *Node) *Node {
+	if len(n.Children) != 1 || n.Children[0].Type != NodeTypeArray || len(n.Children[0].Children) == 0 {
+		return n
+	}
+
+	params := n.Children[0]
+	args := newArrayNode(n)
+	for i, pair := range params.Children {
+		if i == len(params.Children)-1 {
+			pair.Parent = args
+			args.appendChild(pair)
+			break
+		}
+
+		if pair.Type != NodeTypeArray || len(pair.Children) != 2 || !isBoolLiteral(pair.Children[0]) {
+			pair.Parent = args
+			args.appendChild(pair)
+			continue
+		}
+
+		if pair.Children[0].Token.Value.(bool) {
+			value := pair.Children[1]
+			value.Parent = args
+			args.appendChild(value)
+			break
+		}
+	}
+
+	if len(args.Children) == 1 && (args.Children[0].Type != NodeTypeArray || parent == nil) {
+		value := args.Children[0]
+		value.Parent = parent
+		return value
+	}
+
+	n.Children = []*Node{args}
+	return n
+}
@@ -0,0 +1,175 @@
+package condition
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		expression string
+		optimized  string
+	}{
+		{expression: `{"and": [true, {"context": "a"}]}`, optimized: `{"and": [{"context": "a"}]}`},
+		{expression: `{"and": [true, {"eq": [{"context": "a"}, 1]}]}`, optimized: `{"eq": [{"context": "a"}, 1]}`},
+		{expression: `{"and": [{"gt": [2, 1]}, {"eq": [{"context": "a"}, 1]}]}`, optimized: `{"eq": [{"context": "a"}, 1]}`},
+		{expression: `{"and": [{"context": "a"}, false, {"context": "b"}]}`, optimized: `{"and": [{"context": "a"}, false]}`},
+		{expression: `{"and": [false, {"context": "b"}]}`, optimized: `false`},
+		{expression: `{"or": [{"context": "a"}, {"or": [{"context": "b"}, {"context": "a"}]}, false]}`, optimized: `{"or": [{"context": "a"}, {"context": "b"}]}`},
+		{expression: `{"and": [{"context": "a"}, {"and": [{"context": "b"}, {"or": [{"context": "c"}]}]}]}`, optimized: `{"and": [{"context": "a"}, {"context": "b"}, {"or": [{"context": "c"}]}]}`},
+		{expression: `{"and": [1, {"context": "a"}]}`, optimized: `{"and": [1, {"context": "a"}]}`},
+		{expression: `{"not": {"not": {"eq": [{"context": "a"}, 1]}}}`, optimized: `{"eq": [{"context": "a"}, 1]}`},
+		{expression: `{"not": {"not": {"context": "a"}}}`, optimized: `{"not": {"not": {"context": "a"}}}`},
+		{expression: `{"not": [{"not": [{"eq": [{"context": "a"}, 1]}]}]}`, optimized: `{"not": [{"not": [{"eq": [{"context": "a"}, 1]}]}]}`},
+		{expression: `{"not": [{"not": [true]}]}`, optimized: `{"not": [{"not": [true]}]}`},
+		{expression: `{"if": [{"eq": [1, 1]}, {"context": "a"}, {"context": "b"}]}`, optimized: `{"context": "a"}`},
+		{expression: `{"if": [false, {"context": "a"}]}`, optimized: `null`},
+		{expression: `{"cond": [[false, 1], [{"context": "a"}, 2], [true, {"context": "b"}], 3]}`, optimized: `{"cond": [[{"context": "a"}, 2], {"context": "b"}]}`},
+		{expression: `{"cond": [[false, 1], {"context": "b"}]}`, optimized: `{"context": "b"}`},
+		{expression: `{"let": [{"x": 2}, {"gt": [{"var": "x"}, 1]}]}`, optimized: `true`},
+		{expression: `{"let": [{"md5": {"sha256": "a"}}, {"eq": [{"var": "md5"}, {"context": "a"}]}]}`, optimized: `{"let": [{"md5": "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb"}, {"eq": [{"var": "md5"}, {"context": "a"}]}]}`},
+		{expression: `{"eq": [{"if": [true, [1, 2]]}, {"context": "a"}]}`, optimized: `{"eq": [{"if": [true, [1, 2]]}, {"context": "a"}]}`},
+		{expression: `{"object": ["a", 1]}`, optimized: `{"object": ["a", 1]}`},
+		{expression: `{"try": [{"gt": ["a", 1]}, false]}`, optimized: `{"try": [{"gt": ["a", 1]}, false]}`},
+		{expression: `{"in_window": ["mon", "09:00", "17:00"]}`, optimized: `{"in_window": ["mon", "09:00", "17:00"]}`},
+		{expression: `{"gt": ["a", 1]}`, optimized: `{"gt": ["a", 1]}`},
+		{expression: `{"my_macro": [{"gt": [2, 1]}]}`, optimized: `{"my_macro": [true]}`},
+	}
+
+	for _, test := range tests {
+		root := mustParse(t, test.expression)
+		before := Stringify(root)
+
+		optimized := Optimize(root)
+		checkParents(t, optimized)
+
+		if Stringify(root) != before {
+			t.Errorf("%s: input was modified", test.expression)
+		}
+
+		if got, expected := Stringify(optimized), Stringify(mustParse(t, test.optimized)); got != expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", test.expression, expected, got)
+		}
+	}
+}
+
+func TestOptimizeDigest(t *testing.T) {
+	root := mustParse(t, `{"sha256": {"md5": "a"}}`)
+	expected, err := NewDefaultEvaluator().Evaluate(nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	optimized := Optimize(root)
+	if v, ok := literalValue(optimized); !ok || v != expected {
+		t.Errorf("expected %v got\n%s", expected, Stringify(optimized))
+	}
+}
+
+func TestRegistryOptimize(t *testing.T) {
+	// Functions missing from the registry are not folded or simplified.
+	registry := NewRegistry()
+	spec, _ := DefaultRegistry.Lookup("eq")
+	registry.MustRegister("equals", spec)
+
+	optimized := registry.Optimize(mustParse(t, `{"and": [true, {"equals": [1, 1]}, {"eq": [1, 1]}]}`))
+	expected := mustParse(t, `{"and": [true, true, {"eq": [1, 1]}]}`)
+	if Stringify(optimized) != Stringify(expected) {
+		t.Errorf("expected\n%s\ngot\n%s", Stringify(expected), Stringify(optimized))
+	}
+}
+
+// conditionGenerator generates random conditions from a small set of
+// operands, so that conditions often contain repeated operands.
+type conditionGenerator struct {
+	rnd *rand.Rand
+}
+
+func (g *conditionGenerator) operand() string {
+	operands := []string{
+		`true`, `false`, `1`, `0`, `"a"`, `null`, `[1, 2]`,
+		`{"context": "a"}`, `{"context": "b"}`, `{"context": "n"}`, `{"context": "missing"}`,
+		`{"eq": [{"context": "n"}, 1]}`, `{"gt": [{"context": "n"}, 0]}`,
+	}
+	return operands[g.rnd.Intn(len(operands))]
+}
+
+func (g *conditionGenerator) expression(depth int) string {
+	if depth == 0 || g.rnd.Intn(4) == 0 {
+		return g.operand()
+	}
+
+	e := func() string {
+		return g.expression(depth - 1)
+	}
+
+	switch g.rnd.Intn(12) {
+	case 0, 1:
+		return fmt.Sprintf(`{"and": [%s]}`, g.list(depth-1))
+	case 2, 3:
+		return fmt.Sprintf(`{"or": [%s]}`, g.list(depth-1))
+	case 4:
+		return fmt.Sprintf(`{"not": %s}`, e())
+	case 5:
+		return fmt.Sprintf(`{"if": [%s, %s, %s]}`, e(), e(), e())
+	case 6:
+		return fmt.Sprintf(`{"cond": [[%s, %s], [%s, %s], %s]}`, e(), e(), e(), e(), e())
+	case 7:
+		return fmt.Sprintf(`{"eq": [%s, %s]}`, e(), e())
+	case 8:
+		return fmt.Sprintf(`{"gt": [%s, %s]}`, e(), e())
+	case 9:
+		return fmt.Sprintf(`{"let": [{"x": %s}, {"or": [{"var": "x"}, %s]}]}`, e(), e())
+	case 10:
+		return fmt.Sprintf(`{"not": [%s]}`, e())
+	}
+
+	return fmt.Sprintf(`{"coalesce": [%s, %s]}`, e(), e())
+}
+
+func (g *conditionGenerator) list(depth int) string {
+	items := make([]string, g.rnd.Intn(4))
+	for i := range items {
+		items[i] = g.expression(depth)
+	}
+	return strings.Join(items, ", ")
+}
+
+func TestOptimizePreservesResults(t *testing.T) {
+	g := &conditionGenerator{rnd: rand.New(rand.NewSource(1))}
+
+	contexts := []map[string]interface{}{
+		{"a": true, "b": false, "n": 1.0},
+		{"a": false, "b": true, "n": 0.0},
+		{"a": "x", "b": nil, "n": 2.0},
+		{},
+	}
+
+	options := []Options{
+		{},
+		{Strict: true},
+		{Truthiness: TruthinessNonEmpty},
+	}
+
+	evaluator := NewDefaultEvaluator()
+	for i := 0; i < 2000; i++ {
+		expression := g.expression(4)
+		root := mustParse(t, expression)
+		optimized := Optimize(root)
+
+		for _, ctx := range contexts {
+			for _, opts := range options {
+				expected, expectedErr := evaluator.EvaluateWithOptions(ctx, root, opts)
+				got, gotErr := evaluator.EvaluateWithOptions(ctx, optimized, opts)
+
+				if (expectedErr == nil) != (gotErr == nil) || ErrorKindOf(expectedErr) != ErrorKindOf(gotErr) || !reflect.DeepEqual(got, expected) {
+					t.Fatalf("%s with %v and %+v: expected %v, %v got %v, %v\noptimized:\n%s",
+						expression, ctx, opts, expected, expectedErr, got, gotErr, Stringify(optimized))
+				}
+			}
+		}
+	}
+}
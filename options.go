@@ -0,0 +1,72 @@
+package condition
+
+import (
+	"fmt"
+)
+
+// Truthiness defines how non-boolean values are converted to booleans when
+// they are used as predicates.
+type Truthiness int
+
+const (
+	// TruthinessNonNull treats every value except null and false as true.
+	TruthinessNonNull Truthiness = iota
+	// TruthinessNonEmpty treats null, false, 0, empty strings, empty arrays
+	// and empty objects as false and every other value as true.
+	TruthinessNonEmpty
+)
+
+var truthinessNames = map[string]Truthiness{
+	"non_null":  TruthinessNonNull,
+	"non_empty": TruthinessNonEmpty,
+}
+
+// ParseTruthiness returns a truthiness policy by its name, non_null or
+// non_empty. An empty name returns the default policy, TruthinessNonNull.
+func ParseTruthiness(name string) (Truthiness, error) {
+	if name == "" {
+		return TruthinessNonNull, nil
+	}
+
+	truthiness, ok := truthinessNames[name]
+	if !ok {
+		return TruthinessNonNull, fmt.Errorf("unknown truthiness policy %q", name)
+	}
+
+	return truthiness, nil
+}
+
+// Options control how conditions are evaluated.
+type Options struct {
+	// Strict turns missing context paths, non-integer array indexes and
+	// non-boolean predicates in and, or, not, if and cond into errors.
+	Strict bool
+
+	// Truthiness is used to convert non-boolean predicates to booleans when
+	// Strict is off.
+	Truthiness Truthiness
+}
+
+// SetOptions sets options used by Evaluate.
+func (e *Evaluator) SetOptions(options Options) {
+	e.defaultOptions = options
+}
+
+// Options returns options used by Evaluate.
+func (e *Evaluator) Options() Options {
+	return e.defaultOptions
+}
+
+// predicate converts a predicate value to a boolean according to current
+// evaluation options.
+func (e *Evaluator) predicate(v interface{}) (bool, error) {
+	if e.options.Strict {
+		asBool, ok := v.(bool)
+		if !ok {
+			return false, newError(ErrorKindType, "expected boolean predicate, got %s", typeOf(v))
+		}
+		return asBool, nil
+	}
+
+	return castToBool(v, e.options.Truthiness), nil
+}
@@ -0,0 +1,123 @@
+package condition
+
+import (
+	"testing"
+)
+
+func TestTruthiness(t *testing.T) {
+	evaluator := NewDefaultEvaluator()
+
+	testCases := []struct {
+		in         string
+		truthiness Truthiness
+		out        interface{}
+	}{
+		{in: `{"if": [0, "yes", "no"]}`, truthiness: TruthinessNonNull, out: "yes"},
+		{in: `{"if": [0, "yes", "no"]}`, truthiness: TruthinessNonEmpty, out: "no"},
+		{in: `{"if": ["", "yes", "no"]}`, truthiness: TruthinessNonNull, out: "yes"},
+		{in: `{"if": ["", "yes", "no"]}`, truthiness: TruthinessNonEmpty, out: "no"},
+		{in: `{"if": [[], "yes", "no"]}`, truthiness: TruthinessNonEmpty, out: "no"},
+		{in: `{"if": [[0], "yes", "no"]}`, truthiness: TruthinessNonEmpty, out: "yes"},
+		{in: `{"if": [{"context": ["empty"]}, "yes", "no"]}`, truthiness: TruthinessNonEmpty, out: "no"},
+		{in: `{"if": [{"context": ["full"]}, "yes", "no"]}`, truthiness: TruthinessNonEmpty, out: "yes"},
+		{in: `{"if": [1.5, "yes", "no"]}`, truthiness: TruthinessNonEmpty, out: "yes"},
+		{in: `{"if": [null, "yes", "no"]}`, truthiness: TruthinessNonNull, out: "no"},
+		{in: `{"and": [1, "a"]}`, truthiness: TruthinessNonEmpty, out: true},
+		{in: `{"or": [0, ""]}`, truthiness: TruthinessNonEmpty, out: false},
+		{in: `{"not": 0}`, truthiness: TruthinessNonEmpty, out: true},
+		{in: `{"not": 0}`, truthiness: TruthinessNonNull, out: false},
+	}
+
+	for _, test := range testCases {
+		root, err := Parse(test.in)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test.in, err.Error())
+		} else {
+			evaluator.SetOptions(Options{Truthiness: test.truthiness})
+			res, err := evaluator.Evaluate(`{"empty": {}, "full": {"a": 1}}`, root)
+			if err != nil {
+				t.Errorf("%q got an error: %s", test.in, err.Error())
+			} else if res != test.out {
+				t.Errorf("%q expected %v got %v", test.in, test.out, res)
+			}
+		}
+	}
+}
+
+func TestStrictMode(t *testing.T) {
+	context := `{"key": "value", "flag": true, "list": [1, 2], "null": null}`
+	evaluator := NewDefaultEvaluator()
+
+	testCases := []struct {
+		in        string
+		out       interface{}
+		strictErr bool
+	}{
+		{in: `{"context": ["key"]}`, out: "value"},
+		{in: `{"context": ["null"]}`, out: nil},
+		{in: `{"context": ["missing"]}`, out: nil, strictErr: true},
+		{in: `{"context": ["list", 5]}`, out: nil, strictErr: true},
+		{in: `{"context": ["list", 0.5]}`, out: float64(1), strictErr: true},
+		{in: `{"exists": ["missing"]}`, out: false},
+		{in: `{"coalesce": [{"context": ["null"]}, 1]}`, out: float64(1)},
+		{in: `{"and": [true, {"context": ["flag"]}]}`, out: true},
+		{in: `{"and": [true, "yes"]}`, out: true, strictErr: true},
+		{in: `{"or": [false, 1]}`, out: true, strictErr: true},
+		{in: `{"not": null}`, out: true, strictErr: true},
+		{in: `{"if": ["value", 1, 2]}`, out: float64(1), strictErr: true},
+		{in: `{"cond": [[1, 1], 2]}`, out: float64(1), strictErr: true},
+		{in: `{"if": [{"eq": [1, 1]}, 1, 2]}`, out: float64(1)},
+	}
+
+	for _, test := range testCases {
+		root, err := Parse(test.in)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test.in, err.Error())
+			continue
+		}
+
+		res, err := evaluator.Evaluate(context, root)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test.in, err.Error())
+		} else if res != test.out {
+			t.Errorf("%q expected %v got %v", test.in, test.out, res)
+		}
+
+		res, err = evaluator.EvaluateWithOptions(context, root, Options{Strict: true})
+		if test.strictErr {
+			if err == nil {
+				t.Errorf("%q expected an error in strict mode", test.in)
+			}
+		} else if err != nil {
+			t.Errorf("%q got an error in strict mode: %s", test.in, err.Error())
+		} else if res != test.out {
+			t.Errorf("%q expected %v in strict mode got %v", test.in, test.out, res)
+		}
+	}
+}
+
+func TestParseTruthiness(t *testing.T) {
+	testCases := []struct {
+		in  string
+		out Truthiness
+		err bool
+	}{
+		{in: "", out: TruthinessNonNull},
+		{in: "non_null", out: TruthinessNonNull},
+		{in: "non_empty", out: TruthinessNonEmpty},
+		{in: "javascript", err: true},
+	}
+
+	for _, test := range testCases {
+		res, err := ParseTruthiness(test.in)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q expected an error", test.in)
+			}
+		} else if err != nil {
+			t.Errorf("%q got an error: %s", test.in, err.Error())
+		} else if res != test.out {
+			t.Errorf("%q expected %v got %v", test.in, test.out, res)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package condition
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// PartialEvaluate evaluates the parts of root that depend only on the known
+// context and returns a residual condition with those parts replaced by their
+// values. Evaluating the residual condition with the full context gives the
+// same result as evaluating root with it.
+//
+// Context paths missing from the known context are unknown, so are objects,
+// which may be incomplete, and reads with wildcards. Expressions that use the
+// clock, variables bound outside of them or unknown paths are left in the
+// residual condition, as are expressions that fail, so that errors are
+// reported when the condition is finished. Context resolvers are not called.
+//
+// The and, or and if expressions are simplified when some of their arguments
+// are known: a known false operand makes and false and a known true operand
+// makes or true if all operands before it are known. After unknown operands
+// it only drops the operands that follow it. Simplification relies
+// on built-in function names, and, or, if and let registered under other
+// names are only evaluated as a whole.
+func (e *Evaluator) PartialEvaluate(known interface{}, root *Node) (*Node, error) {
+	if root == nil {
+		return nil, errors.New("received nil AST node as an input to evaluator")
+	}
+
+	var ctx string
+	switch t := known.(type) {
+	case string:
+		ctx = t
+	case json.RawMessage:
+		ctx = string(t)
+	}
+
+	if ctx != "" {
+		known = nil
+		if err := json.NewDecoder(strings.NewReader(ctx)).Decode(&known); err != nil {
+			return nil, err
+		}
+	}
+
+	e.context = known
+	e.options = e.defaultOptions
+	e.resolved = nil
+	e.scope = nil
+	e.now = time.Time{}
+	e.partial = true
+
+	residual := e.partialNode(root, nil)
+
+	e.partial = false
+	e.trace = nil
+
+	return residual, nil
+}
+
+// knownContextValue returns the value at path in the known context during
+// partial evaluation. Reads of unknown values mark the current evaluation as
+// unknown.
+func (e *Evaluator) knownContextValue(path []interface{}) (interface{}, error) {
+	for _, element := range path {
+		if key, ok := pathKey(element); ok && key == wildcard {
+			e.unknown = true
+			return nil, newError(ErrorKindMissing, "context path %v is unknown", path)
+		}
+	}
+
+	val, err := e.getPath(e.context, path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch val.(type) {
+	case NotFound, map[string]interface{}:
+		e.unknown = true
+		return nil, newError(ErrorKindMissing, "context path %v is unknown", path)
+	}
+
+	return val, nil
+}
+
+// tryEvaluate evaluates n during partial evaluation. The second return value
+// is false if evaluation failed or used unknown values.
+func (e *Evaluator) tryEvaluate(n *Node) (interface{}, bool) {
+	e.unknown = false
+	val, err := e.evaluateNode(n)
+	return val, err == nil && !e.unknown
+}
+
+// partialNode returns the residual of n as a child of parent.
+func (e *Evaluator) partialNode(n *Node, parent *Node) *Node {
+	if n.Type == NodeTypeLiteral {
+		return newLiteralNode(parent, n.Token)
+	}
+
+	if n.Type == NodeTypeFunction {
+		// Handlers such as and, cond and functions taking a single
+		// argument treat array nodes differently from other arguments, so
+		// functions are only replaced by arrays at the root.
+		if val, ok := e.tryEvaluate(n); ok {
+			if node, ok := valueNode(val, parent); ok && (node.Type != NodeTypeArray || parent == nil) {
+				return node
+			}
+		}
+
+		switch FunctionName(n) {
+		case "and":
+			return e.partialJunction(n, parent, false)
+		case "or":
+			return e.partialJunction(n, parent, true)
+		case "if":
+			return e.partialIf(n, parent)
+		case "let":
+			return e.partialLet(n, parent)
+		case "var":
+			// var requires a literal name, which must not be replaced
+			// by a residual.
+			c := n.Clone()
+			c.Parent = parent
+			return c
+		}
+	}
+
+	return e.partialChildren(n, parent)
+}
+
+// partialChildren copies n and replaces its children with their residuals.
+func (e *Evaluator) partialChildren(n *Node, parent *Node) *Node {
+	residual := &Node{
+		Type:   n.Type,
+		Token:  n.Token,
+		Parent: parent,
+	}
+
+	for _, child := range n.Children {
+		residual.appendChild(e.partialNode(child, residual))
+	}
+
+	return residual
+}
+
+// partialJunction simplifies and and or. Known operands other than decisive
+// are removed. A known decisive operand decides the result if all operands
+// before it are known, otherwise it ends the operands, because the unknown
+// ones may still fail or decide the result first.
+func (e *Evaluator) partialJunction(n *Node, parent *Node, decisive bool) *Node {
+	if len(n.Children) != 1 || n.Children[0].Type != NodeTypeArray {
+		return e.partialChildren(n, parent)
+	}
+
+	residual := &Node{
+		Type:   n.Type,
+		Token:  n.Token,
+		Parent: parent,
+	}
+	operands := newArrayNode(residual)
+	residual.appendChild(operands)
+
+	for _, operand := range n.Children[0].Children {
+		operandResidual := e.partialNode(operand, operands)
+
+		if val, ok := literalValue(operandResidual); ok {
+			if b, err := e.predicate(val); err == nil {
+				if b != decisive {
+					continue
+				}
+				if len(operands.Children) == 0 {
+					return valueNodeOf(decisive, parent)
+				}
+				operands.appendChild(operandResidual)
+				break
+			}
+		}
+
+		operands.appendChild(operandResidual)
+	}
+
+	if len(operands.Children) == 0 {
+		return valueNodeOf(!decisive, parent)
+	}
+
+	return residual
+}
+
+// partialIf replaces if with one of its branches if the predicate is known.
+func (e *Evaluator) partialIf(n *Node, parent *Node) *Node {
+	params := functionArgs(n)
+	if len(params) != 2 && len(params) != 3 {
+		return e.partialChildren(n, parent)
+	}
+
+	predicate := e.partialNode(params[0], nil)
+	val, ok := literalValue(predicate)
+	if !ok {
+		return e.partialChildren(n, parent)
+	}
+
+	b, err := e.predicate(val)
+	if err != nil {
+		return e.partialChildren(n, parent)
+	}
+
+	branch := valueNodeOf(nil, parent)
+	if b {
+		branch = e.partialNode(params[1], parent)
+	} else if len(params) == 3 {
+		branch = e.partialNode(params[2], parent)
+	}
+
+	if branch.Type == NodeTypeArray && parent != nil {
+		return e.partialChildren(n, parent)
+	}
+
+	return branch
+}
+
+// partialLet keeps variable bindings of let and replaces bound expressions
+// and the body with their residuals.
+func (e *Evaluator) partialLet(n *Node, parent *Node) *Node {
+	if len(n.Children) != 1 || n.Children[0].Type != NodeTypeArray {
+		return e.partialChildren(n, parent)
+	}
+
+	residual := &Node{
+		Type:   n.Type,
+		Token:  n.Token,
+		Parent: parent,
+	}
+	params := newArrayNode(residual)
+	residual.appendChild(params)
+
+	children := n.Children[0].Children
+	for i, param := range children {
+		if i == len(children)-1 || param.Type != NodeTypeFunction {
+			params.appendChild(e.partialNode(param, params))
+			continue
+		}
+
+		binding := &Node{
+			Type:   param.Type,
+			Token:  param.Token,
+			Parent: params,
+		}
+		for _, child := range param.Children {
+			binding.appendChild(e.partialNode(child, binding))
+		}
+		params.appendChild(binding)
+	}
+
+	return residual
+}
+
+// valueNode converts an evaluated value to a node. Objects can't be written
+// as literals, the second return value is false if val contains one.
+func valueNode(val interface{}, parent *Node) (*Node, bool) {
+	switch v := val.(type) {
+	case nil, bool, float64, string:
+		return valueNodeOf(v, parent), true
+	case []interface{}:
+		n := newArrayNode(parent)
+		for _, item := range v {
+			child, ok := valueNode(item, n)
+			if !ok {
+				return nil, false
+			}
+			n.appendChild(child)
+		}
+		return n, true
+	}
+
+	return nil, false
+}
+
+// valueNodeOf returns a literal node for a null, boolean, number or string.
+func valueNodeOf(val interface{}, parent *Node) *Node {
+	token := Token{
+		Type:  TokenTypeLiteral,
+		Value: val,
+	}
+
+	switch val.(type) {
+	case nil:
+		token.LiteralType = LiteralTypeNull
+	case bool:
+		token.LiteralType = LiteralTypeBool
+	case float64:
+		token.LiteralType = LiteralTypeNumber
+	case string:
+		token.LiteralType = LiteralTypeString
+	}
+
+	return newLiteralNode(parent, token)
+}
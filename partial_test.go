@@ -0,0 +1,207 @@
+package condition
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// checkParents fails if a child of n doesn't point back to its parent.
+func checkParents(t *testing.T, n *Node) {
+	t.Helper()
+	for _, child := range n.Children {
+		if child.Parent != n {
+			t.Fatalf("child %s of %s has wrong parent", getNodeName(child), getNodeName(n))
+		}
+		checkParents(t, child)
+	}
+}
+
+func TestPartialEvaluate(t *testing.T) {
+	known := map[string]interface{}{
+		"country": "US",
+		"device":  "mobile",
+		"tags":    []interface{}{"a", "b"},
+		"user":    map[string]interface{}{"age": 30.0},
+	}
+
+	tests := []struct {
+		expression string
+		residual   string
+	}{
+		{
+			expression: `{"eq": [{"context": "country"}, "US"]}`,
+			residual:   `true`,
+		},
+		{
+			expression: `{"and": [{"eq": [{"context": "tier"}, "gold"]}, {"eq": [{"context": "country"}, "US"]}]}`,
+			residual:   `{"and": [{"eq": [{"context": "tier"}, "gold"]}]}`,
+		},
+		{
+			expression: `{"and": [{"eq": [{"context": "country"}, "CA"]}, {"eq": [{"context": "tier"}, "gold"]}]}`,
+			residual:   `false`,
+		},
+		{
+			// Unknown operands before a decisive one may still fail.
+			expression: `{"and": [{"eq": [{"context": "tier"}, "gold"]}, {"eq": [{"context": "country"}, "CA"]}, {"context": "beta"}]}`,
+			residual:   `{"and": [{"eq": [{"context": "tier"}, "gold"]}, false]}`,
+		},
+		{
+			expression: `{"or": [{"eq": [{"context": "device"}, "mobile"]}, {"eq": [{"context": "tier"}, "gold"]}]}`,
+			residual:   `true`,
+		},
+		{
+			expression: `{"or": [{"eq": [{"context": "tier"}, "gold"]}, {"eq": [{"context": "device"}, "mobile"]}]}`,
+			residual:   `{"or": [{"eq": [{"context": "tier"}, "gold"]}, true]}`,
+		},
+		{
+			expression: `{"or": [{"eq": [{"context": "tier"}, "gold"]}, {"eq": [{"context": "device"}, "desktop"]}, {"context": "beta"}]}`,
+			residual:   `{"or": [{"eq": [{"context": "tier"}, "gold"]}, {"context": "beta"}]}`,
+		},
+		{
+			expression: `{"if": [{"eq": [{"context": "country"}, "US"]}, {"context": "tier"}, "none"]}`,
+			residual:   `{"context": "tier"}`,
+		},
+		{
+			expression: `{"if": [{"eq": [{"context": "country"}, "CA"]}, {"context": "tier"}]}`,
+			residual:   `null`,
+		},
+		{
+			expression: `{"if": [{"context": "beta"}, {"context": "device"}, {"context": "country"}]}`,
+			residual:   `{"if": [{"context": "beta"}, "mobile", "US"]}`,
+		},
+		{
+			// Arrays are only folded at the root.
+			expression: `{"context": "tags"}`,
+			residual:   `["a", "b"]`,
+		},
+		{
+			expression: `{"eq": [{"context": "tags"}, {"context": "beta"}]}`,
+			residual:   `{"eq": [{"context": "tags"}, {"context": "beta"}]}`,
+		},
+		{
+			// Objects may be incomplete.
+			expression: `{"get": [{"context": "user"}, "age"]}`,
+			residual:   `{"get": [{"context": "user"}, "age"]}`,
+		},
+		{
+			expression: `{"context": "user.age"}`,
+			residual:   `30`,
+		},
+		{
+			expression: `{"exists": "user.tier"}`,
+			residual:   `{"exists": "user.tier"}`,
+		},
+		{
+			expression: `{"let": [{"c": {"context": "country"}}, {"t": {"context": "tier"}}, {"and": [{"eq": [{"var": "c"}, "US"]}, {"var": "t"}]}]}`,
+			residual:   `{"let": [{"c": "US"}, {"t": {"context": "tier"}}, {"and": [{"eq": [{"var": "c"}, "US"]}, {"var": "t"}]}]}`,
+		},
+		{
+			// try must not hide unknown values.
+			expression: `{"try": [{"gt": [{"context": "score"}, 1]}, false]}`,
+			residual:   `{"try": [{"gt": [{"context": "score"}, 1]}, false]}`,
+		},
+		{
+			// Errors are reported when the condition is finished.
+			expression: `{"or": [{"context": "beta"}, {"gt": [{"context": "country"}, 1]}]}`,
+			residual:   `{"or": [{"context": "beta"}, {"gt": ["US", 1]}]}`,
+		},
+		{
+			expression: `{"and": [{"in_window": ["mon-fri", "09:00", "17:00"]}, {"context": "country"}]}`,
+			residual:   `{"and": [{"in_window": ["mon-fri", "09:00", "17:00"]}]}`,
+		},
+	}
+
+	evaluator := NewDefaultEvaluator()
+	for _, test := range tests {
+		residual, err := evaluator.PartialEvaluate(known, mustParse(t, test.expression))
+		if err != nil {
+			t.Fatalf("%s: %s", test.expression, err.Error())
+		}
+		checkParents(t, residual)
+
+		if got, expected := Stringify(residual), Stringify(mustParse(t, test.residual)); got != expected {
+			t.Errorf("%s: expected residual\n%s\ngot\n%s", test.expression, expected, got)
+		}
+	}
+}
+
+func TestPartialEvaluateJSONContext(t *testing.T) {
+	evaluator := NewDefaultEvaluator()
+
+	residual, err := evaluator.PartialEvaluate(`{"country": "US"}`, mustParse(t, `{"eq": [{"context": "country"}, "US"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := literalValue(residual); !ok || v != true {
+		t.Errorf("expected true got %s", Stringify(residual))
+	}
+
+	if _, err := evaluator.PartialEvaluate(`{"country"`, mustParse(t, `true`)); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestPartialThenFullEvaluation(t *testing.T) {
+	conditions := []string{
+		`{"and": [{"eq": [{"context": "country"}, "US"]}, {"gte": [{"context": "age"}, 18]}, {"eq": [{"context": "tier"}, "gold"]}]}`,
+		`{"and": [{"gt": [{"context": "tier"}, 1]}, {"eq": [{"context": "country"}, "US"]}]}`,
+		`{"or": [{"eq": [{"context": "tier"}, "gold"]}, {"and": [{"eq": [{"context": "device"}, "mobile"]}, {"not": {"context": "blocked"}}]}]}`,
+		`{"if": [{"eq": [{"context": "country"}, "US"]}, {"gt": [{"context": "age"}, 21]}, {"gt": [{"context": "age"}, 18]}]}`,
+		`{"cond": [[{"eq": [{"context": "tier"}, "gold"]}, "gold"], [{"eq": [{"context": "device"}, "mobile"]}, "mobile"], "other"]}`,
+		`{"let": [{"adult": {"gte": [{"context": "age"}, 18]}}, {"and": [{"var": "adult"}, {"or": [{"context": "blocked"}, {"eq": [{"context": "country"}, "US"]}]}]}]}`,
+		`{"switch": [{"context": "tier"}, ["gold", {"context": "country"}], ["silver", {"context": "device"}], "none"]}`,
+		`{"coalesce": [{"context": "nickname"}, {"context": "country"}]}`,
+		`{"try": [{"gt": [{"context": "tier"}, 1]}, {"context": "device"}]}`,
+		`{"exists": "blocked"}`,
+		`{"and": [{"in_window": ["mon-fri", "09:00", "17:00"]}, {"eq": [{"context": "device"}, "mobile"]}]}`,
+		`{"sha256": {"context": "country"}}`,
+		`{"default": [{"context": "tier"}, {"context": "device"}]}`,
+	}
+
+	contexts := []map[string]interface{}{
+		{"country": "US", "age": 30.0, "tier": "gold", "device": "mobile", "blocked": false},
+		{"country": "CA", "age": 19.0, "tier": "silver", "device": "desktop", "blocked": true},
+		{"country": "US", "age": 16.0, "device": "mobile", "nickname": "x"},
+		{"age": 40.0, "tier": "bronze", "blocked": false},
+	}
+
+	evaluator := NewDefaultEvaluator()
+	evaluator.SetClock(func() time.Time {
+		return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	})
+
+	for _, expression := range conditions {
+		root := mustParse(t, expression)
+
+		for _, full := range contexts {
+			expected, expectedErr := evaluator.Evaluate(full, root)
+
+			keys := []string{}
+			for key := range full {
+				keys = append(keys, key)
+			}
+
+			// Every subset of keys of the full context is a known context.
+			for mask := 0; mask < 1<<len(keys); mask++ {
+				known := map[string]interface{}{}
+				for i, key := range keys {
+					if mask&(1<<i) != 0 {
+						known[key] = full[key]
+					}
+				}
+
+				residual, err := evaluator.PartialEvaluate(known, root)
+				if err != nil {
+					t.Fatalf("%s with %v: %s", expression, known, err.Error())
+				}
+
+				got, gotErr := evaluator.Evaluate(full, residual)
+				if (expectedErr == nil) != (gotErr == nil) || !reflect.DeepEqual(got, expected) {
+					t.Errorf("%s with known %v and full %v: expected %v, %v got %v, %v\nresidual:\n%s",
+						expression, known, full, expected, expectedErr, got, gotErr, Stringify(residual))
+				}
+			}
+		}
+	}
+}
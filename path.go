@@ -0,0 +1,55 @@
+package condition
+
+import (
+	"strings"
+)
+
+// wildcard is a path element that matches every element of an array or every
+// value of an object.
+const wildcard = "*"
+
+// pathToken is a path element parsed from a path string. Unlike string path
+// elements, it can also be used as an index into an array.
+type pathToken string
+
+// pathKey returns the object key for a path element.
+func pathKey(element interface{}) (string, bool) {
+	switch v := element.(type) {
+	case string:
+		return v, true
+	case pathToken:
+		return string(v), true
+	}
+	return "", false
+}
+
+// parsePathString parses a JSON Pointer (RFC 6901), e.g. "/users/0/name", or a
+// dotted path, e.g. "users.0.name", into path elements. An empty string refers
+// to the whole document.
+func parsePathString(path string) ([]interface{}, error) {
+	elements := []interface{}{}
+	if path == "" {
+		return elements, nil
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		for _, segment := range strings.Split(path, ".") {
+			elements = append(elements, pathToken(segment))
+		}
+		return elements, nil
+	}
+
+	for _, segment := range strings.Split(path[1:], "/") {
+		for i := 0; i < len(segment); i++ {
+			if segment[i] == '~' && (i+1 >= len(segment) || (segment[i+1] != '0' && segment[i+1] != '1')) {
+				return nil, newError(ErrorKindValue, "invalid escape sequence in JSON pointer %q", path)
+			}
+		}
+
+		segment = strings.ReplaceAll(segment, "~1", "/")
+		segment = strings.ReplaceAll(segment, "~0", "~")
+		elements = append(elements, pathToken(segment))
+	}
+
+	return elements, nil
+}
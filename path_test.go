@@ -0,0 +1,122 @@
+package condition
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePathString(t *testing.T) {
+	testCases := []struct {
+		in  string
+		out []interface{}
+		err bool
+	}{
+		{in: "", out: []interface{}{}},
+		{in: "key", out: []interface{}{pathToken("key")}},
+		{in: "key.0.sub", out: []interface{}{pathToken("key"), pathToken("0"), pathToken("sub")}},
+		{in: "/", out: []interface{}{pathToken("")}},
+		{in: "/key/0/sub", out: []interface{}{pathToken("key"), pathToken("0"), pathToken("sub")}},
+		{in: "/a~1b/c~0d/~01", out: []interface{}{pathToken("a/b"), pathToken("c~d"), pathToken("~1")}},
+		{in: "/a.b", out: []interface{}{pathToken("a.b")}},
+		{in: "/a~2", err: true},
+		{in: "/a~", err: true},
+	}
+
+	for _, test := range testCases {
+		res, err := parsePathString(test.in)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q expected an error", test.in)
+			}
+		} else if err != nil {
+			t.Errorf("%q got an error: %s", test.in, err.Error())
+		} else if !reflect.DeepEqual(res, test.out) {
+			t.Errorf("%q expected %v got %v", test.in, test.out, res)
+		}
+	}
+}
+
+func TestContextPaths(t *testing.T) {
+	context := `{
+			"key": "value",
+			"a/b": 1,
+			"a.b": 2,
+			"list": [1, 2, 3],
+			"users": [
+				{"name": "a", "email": "a@example.com", "roles": ["admin", "dev"]},
+				{"name": "b", "roles": ["dev"]},
+				{"name": "c", "email": "c@example.com", "roles": []}
+			],
+			"flags": {"z": true, "a": false, "m": null}
+		}`
+	evaluator := NewDefaultEvaluator()
+
+	testCases := []struct {
+		in  string
+		out interface{}
+	}{
+		{in: `{"context": "key"}`, out: "value"},
+		{in: `{"context": "/key"}`, out: "value"},
+		{in: `{"context": "/a~1b"}`, out: float64(1)},
+		{in: `{"context": "/a.b"}`, out: float64(2)},
+		{in: `{"context": ["a.b"]}`, out: float64(2)},
+		{in: `{"context": "list.1"}`, out: float64(2)},
+		{in: `{"context": "/list/2"}`, out: float64(3)},
+		{in: `{"context": "list.-1"}`, out: float64(3)},
+		{in: `{"context": ["list", -1]}`, out: float64(3)},
+		{in: `{"context": ["list", -3]}`, out: float64(1)},
+		{in: `{"context": ["list", -4]}`, out: nil},
+		{in: `{"context": ["list", 3]}`, out: nil},
+		{in: `{"context": "users.0.name"}`, out: "a"},
+		{in: `{"context": ["users", -1, "roles"]}`, out: []interface{}{}},
+		{in: `{"context": ["users", "*", "name"]}`, out: []interface{}{"a", "b", "c"}},
+		{in: `{"context": "users.*.email"}`, out: []interface{}{"a@example.com", "c@example.com"}},
+		{in: `{"context": "/users/*/roles/*"}`, out: []interface{}{"admin", "dev", "dev"}},
+		{in: `{"context": "users.*.roles.0"}`, out: []interface{}{"admin", "dev"}},
+		{in: `{"context": "flags.*"}`, out: []interface{}{false, nil, true}},
+		{in: `{"context": "users.*.missing"}`, out: []interface{}{}},
+		{in: `{"get": [{"context": "users.1"}, "name"]}`, out: "b"},
+		{in: `{"context": {"get": [["key", "list"], [1]]}}`, out: []interface{}{float64(1), float64(2), float64(3)}},
+		{in: `{"exists": "users.1.email"}`, out: false},
+		{in: `{"exists": "/users/0/email"}`, out: true},
+		{in: `{"get": [{"context": "users"}, [0, "name"]]}`, out: "a"},
+		{in: `{"get": [{"context": "users"}, "-1.name"]}`, out: "c"},
+		{in: `{"get": [{"context": "users"}, "/1/roles/0"]}`, out: "dev"},
+		{in: `{"get": [{"context": "users"}, "*.name"]}`, out: []interface{}{"a", "b", "c"}},
+		{in: `{"get": [{"context": "users"}, "5.name"]}`, out: nil},
+		{in: `{"get": [[[1, 2], [3, 4]], "*.-1"]}`, out: []interface{}{float64(2), float64(4)}},
+		{in: `{"get": [{"context": "flags"}, ""]}`, out: map[string]interface{}{"z": true, "a": false, "m": nil}},
+	}
+
+	for _, test := range testCases {
+		root, err := Parse(test.in)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test.in, err.Error())
+		} else {
+			res, err := evaluator.Evaluate(context, root)
+			if err != nil {
+				t.Errorf("%q got an error: %s", test.in, err.Error())
+			} else if !reflect.DeepEqual(res, test.out) {
+				t.Errorf("%q expected %v got %v", test.in, test.out, res)
+			}
+		}
+	}
+
+	errorCases := []string{
+		`{"context": "key.sub"}`,
+		`{"context": "list.x"}`,
+		`{"context": 1}`,
+		`{"get": [{"context": "users"}, 1]}`,
+		`{"get": [{"context": "users"}]}`,
+		`{"context": "/a~"}`,
+	}
+
+	for _, test := range errorCases {
+		root, err := Parse(test)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test, err.Error())
+		} else if _, err := evaluator.Evaluate(context, root); err == nil {
+			t.Errorf("%q expected an error", test)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package condition
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ValueType names a JSON value type in function metadata. Type names match
+// the ones returned by the type_of expression.
+type ValueType string
+
+const (
+	TypeAny     ValueType = "any"
+	TypeNull    ValueType = "null"
+	TypeBoolean ValueType = "boolean"
+	TypeNumber  ValueType = "number"
+	TypeString  ValueType = "string"
+	TypeArray   ValueType = "array"
+	TypeObject  ValueType = "object"
+)
+
+// OneOf returns a type that accepts any of the given types, e.g.
+// OneOf(TypeString, TypeNull) is "string|null".
+func OneOf(types ...ValueType) ValueType {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = string(t)
+	}
+	return ValueType(strings.Join(names, "|"))
+}
+
+// Variadic is used as FunctionSpec.MaxArgs for functions that take any number
+// of arguments.
+const Variadic = -1
+
+// ArgSpec describes a single function argument.
+type ArgSpec struct {
+	Name string    `json:"name"`
+	Type ValueType `json:"type"`
+}
+
+// FunctionSpec is a function handler together with its metadata.
+type FunctionSpec struct {
+	Handler ExpressionFunc `json:"-"`
+
+	// MinArgs and MaxArgs bound the number of arguments. Arguments after
+	// MinArgs are optional. MaxArgs is Variadic if there is no upper bound.
+	MinArgs int `json:"min_args"`
+	MaxArgs int `json:"max_args"`
+
+	// Args describe arguments in order. For variadic functions the last
+	// entry describes all remaining arguments.
+	Args []ArgSpec `json:"args"`
+
+	// Returns is the type of the returned value.
+	Returns ValueType `json:"returns"`
+
+	// Pure functions return the same result for the same arguments and
+	// don't read the context, the clock, variables or evaluator state.
+	Pure bool `json:"pure"`
+
+	// Description is a short, one paragraph description of the function.
+	Description string `json:"description"`
+}
+
+// Registry is a set of named functions with their metadata. It is safe for
+// concurrent use.
+type Registry struct {
+	mu    sync.RWMutex
+	specs map[string]FunctionSpec
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		specs: map[string]FunctionSpec{},
+	}
+}
+
+// Register adds a function to the registry. It returns an error if the name
+// is already registered or the spec is invalid.
+func (r *Registry) Register(name string, spec FunctionSpec) error {
+	if name == "" {
+		return fmt.Errorf("function name is empty")
+	}
+
+	if spec.Handler == nil {
+		return fmt.Errorf("function %q has no handler", name)
+	}
+
+	if spec.MinArgs < 0 || (spec.MaxArgs != Variadic && spec.MaxArgs < spec.MinArgs) {
+		return fmt.Errorf("function %q has invalid arity %d..%d", name, spec.MinArgs, spec.MaxArgs)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.specs[name]; ok {
+		return fmt.Errorf("function %q is already registered", name)
+	}
+
+	r.specs[name] = copySpec(spec)
+
+	return nil
+}
+
+// MustRegister is like Register, but panics on error. It is meant to be used
+// in package initialization.
+func (r *Registry) MustRegister(name string, spec FunctionSpec) {
+	if err := r.Register(name, spec); err != nil {
+		panic(err)
+	}
+}
+
+// Lookup returns the spec of a registered function.
+func (r *Registry) Lookup(name string) (FunctionSpec, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	spec, ok := r.specs[name]
+	if !ok {
+		return spec, false
+	}
+
+	return copySpec(spec), true
+}
+
+// Names returns sorted names of all registered functions.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.specs))
+	for name := range r.specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Clone returns an independent copy of the registry. Functions registered in
+// the copy are not visible in the original and vice versa.
+func (r *Registry) Clone() *Registry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	clone := NewRegistry()
+	for name, spec := range r.specs {
+		clone.specs[name] = copySpec(spec)
+	}
+
+	return clone
+}
+
+// NewEvaluator creates an evaluator with handlers for all functions in the
+// registry.
+func (r *Registry) NewEvaluator() *Evaluator {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	evaluator := NewEvaluator()
+	for name, spec := range r.specs {
+		evaluator.AddFunction(name, spec)
+	}
+
+	return evaluator
+}
+
+// AddFunction adds a handler for a function described by spec. The number of
+// arguments is checked against MinArgs and MaxArgs before the handler is
+// called.
+func (e *Evaluator) AddFunction(name string, spec FunctionSpec) {
+	e.AddHandler(name, spec.checkedHandler())
+}
+
+// checkedHandler returns the spec handler wrapped with a check of the number
+// of arguments.
+func (s FunctionSpec) checkedHandler() ExpressionFunc {
+	handler, min, max := s.Handler, s.MinArgs, s.MaxArgs
+	return func(e *Evaluator, n *Node) (interface{}, error) {
+		if err := expectArgs(len(functionArgs(n)), min, max); err != nil {
+			return nil, err
+		}
+		return handler(e, n)
+	}
+}
+
+func copySpec(spec FunctionSpec) FunctionSpec {
+	spec.Args = append([]ArgSpec(nil), spec.Args...)
+	return spec
+}
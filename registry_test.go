@@ -0,0 +1,171 @@
+package condition
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	handler := func(e *Evaluator, n *Node) (interface{}, error) { return "ok", nil }
+
+	if err := registry.Register("f", FunctionSpec{Handler: handler, MinArgs: 1, MaxArgs: 2, Args: []ArgSpec{anyArg}}); err != nil {
+		t.Fatal(err)
+	}
+
+	errorCases := []struct {
+		name string
+		spec FunctionSpec
+	}{
+		{name: "f", spec: FunctionSpec{Handler: handler}},
+		{name: "", spec: FunctionSpec{Handler: handler}},
+		{name: "g", spec: FunctionSpec{}},
+		{name: "g", spec: FunctionSpec{Handler: handler, MinArgs: 2, MaxArgs: 1}},
+		{name: "g", spec: FunctionSpec{Handler: handler, MinArgs: -1, MaxArgs: 1}},
+	}
+
+	for _, test := range errorCases {
+		if err := registry.Register(test.name, test.spec); err == nil {
+			t.Errorf("registering %q expected an error", test.name)
+		}
+	}
+
+	spec, ok := registry.Lookup("f")
+	if !ok || spec.MinArgs != 1 || spec.MaxArgs != 2 {
+		t.Fatalf("unexpected spec %#v", spec)
+	}
+
+	// Specs returned by Lookup don't share state with the registry.
+	spec.Args[0].Name = "changed"
+	if spec, _ := registry.Lookup("f"); spec.Args[0].Name != "value" {
+		t.Errorf("expected registry spec to be unchanged, got %q", spec.Args[0].Name)
+	}
+
+	if _, ok := registry.Lookup("g"); ok {
+		t.Errorf("expected g not to be registered")
+	}
+
+	clone := registry.Clone()
+	clone.MustRegister("g", FunctionSpec{Handler: handler, MinArgs: 1, MaxArgs: 1})
+	if _, ok := registry.Lookup("g"); ok {
+		t.Errorf("expected g not to be registered in the original registry")
+	}
+	if names := clone.Names(); len(names) != 2 || names[0] != "f" || names[1] != "g" {
+		t.Errorf("unexpected clone names %v", names)
+	}
+
+	root, err := Parse(`{"g": 1}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := clone.NewEvaluator().Evaluate(nil, root); err != nil || res != "ok" {
+		t.Errorf("expected ok got %v, %v", res, err)
+	}
+	if _, err := registry.NewEvaluator().Evaluate(nil, root); ErrorKindOf(err) != ErrorKindUndefined {
+		t.Errorf("expected undefined function error, got %v", err)
+	}
+
+	// The number of arguments is checked before the handler is called.
+	for _, in := range []string{`{"g": []}`, `{"g": [1, 2]}`} {
+		root, err := Parse(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := clone.NewEvaluator().Evaluate(nil, root); ErrorKindOf(err) != ErrorKindArity {
+			t.Errorf("%s: expected arity error, got %v", in, err)
+		}
+	}
+}
+
+func TestRegistryConcurrentRegister(t *testing.T) {
+	registry := NewRegistry()
+	handler := func(e *Evaluator, n *Node) (interface{}, error) { return nil, nil }
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			registry.MustRegister(fmt.Sprintf("f%d", i), FunctionSpec{Handler: handler})
+			registry.Names()
+		}(i)
+	}
+	wg.Wait()
+
+	if names := registry.Names(); len(names) != 50 {
+		t.Errorf("expected 50 functions got %d", len(names))
+	}
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	names := DefaultRegistry.Names()
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("expected sorted names, got %v", names)
+	}
+
+	if len(names) != len(ExpressionRegistry) {
+		t.Errorf("expected %d functions got %d", len(ExpressionRegistry), len(names))
+	}
+
+	for _, name := range names {
+		spec, _ := DefaultRegistry.Lookup(name)
+		if _, ok := ExpressionRegistry[name]; !ok {
+			t.Errorf("%q is missing from ExpressionRegistry", name)
+		}
+
+		if spec.Description == "" || spec.Returns == "" {
+			t.Errorf("%q has no description or return type", name)
+		}
+
+		if spec.MaxArgs != Variadic && len(spec.Args) != spec.MaxArgs {
+			t.Errorf("%q describes %d arguments, but takes up to %d", name, len(spec.Args), spec.MaxArgs)
+		}
+
+		if spec.MaxArgs == Variadic && len(spec.Args) == 0 {
+			t.Errorf("%q is variadic, but has no arguments described", name)
+		}
+	}
+}
+
+func TestDefaultRegistryArity(t *testing.T) {
+	evaluator := DefaultRegistry.NewEvaluator()
+	legacy := NewEvaluator()
+	raw := NewEvaluator()
+	for name, handler := range ExpressionRegistry {
+		legacy.AddHandler(name, handler)
+
+		spec, _ := DefaultRegistry.Lookup(name)
+		raw.AddHandler(name, spec.Handler)
+	}
+
+	tests := []string{
+		`{"gt": [1]}`,
+		`{"var": []}`,
+		`{"keys": []}`,
+		`{"let": []}`,
+		`{"cond": []}`,
+		`{"switch": [1]}`,
+		`{"sha1mod": ["x"]}`,
+		`{"hashmod": ["sha1", "value"]}`,
+		`{"variant": ["x", null]}`,
+		`{"geo_distance": [[1, 2]]}`,
+		`{"geo_in_polygon": [[0, 0]]}`,
+		`{"in_schedule": ["* * * * *"]}`,
+		`{"has_key": [{"object": []}]}`,
+	}
+
+	for _, in := range tests {
+		root, err := Parse(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, e := range []*Evaluator{evaluator, legacy, raw} {
+			if _, err := e.Evaluate(nil, root); ErrorKindOf(err) != ErrorKindArity {
+				t.Errorf("%s: expected arity error, got %v", in, err)
+			}
+		}
+	}
+}
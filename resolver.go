@@ -0,0 +1,226 @@
+package condition
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContextResolver fetches a top level context value on demand. Resolvers are
+// registered on an Evaluator for a context key and are consulted by the
+// context expression only when that key is missing from the context passed to
+// Evaluate. Resolved values are memoized for the duration of one evaluation.
+type ContextResolver interface {
+	// Resolve returns the value of key. ctx is the decoded evaluation
+	// context and can be used to look up identifiers needed to fetch the
+	// value. Returning nil means that there is no value for the key.
+	Resolve(ctx interface{}, key string) (interface{}, error)
+}
+
+// ContextResolverFunc allows using ordinary functions as context resolvers.
+type ContextResolverFunc func(ctx interface{}, key string) (interface{}, error)
+
+func (f ContextResolverFunc) Resolve(ctx interface{}, key string) (interface{}, error) {
+	return f(ctx, key)
+}
+
+// resolveContextKey returns a value for key from a registered resolver. The
+// second return value is false if there is no resolver registered for key.
+func (e *Evaluator) resolveContextKey(ctx interface{}, key string) (interface{}, bool, error) {
+	resolver, ok := e.resolvers[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	if val, ok := e.resolved[key]; ok {
+		return val, true, nil
+	}
+
+	val, err := resolver.Resolve(ctx, key)
+	if err != nil {
+		return nil, true, newError(ErrorKindResolver, "resolving %q: %s", key, err.Error())
+	}
+
+	if e.resolved == nil {
+		e.resolved = map[string]interface{}{}
+	}
+	e.resolved[key] = val
+
+	return val, true, nil
+}
+
+// lookupKey converts a context value at keyPath to a string that can be used
+// to look up a resolver record. The second return value is false if the path
+// does not point to a string, number or bool value.
+func lookupKey(ctx interface{}, keyPath []interface{}) (string, bool) {
+	switch v := recursiveGet(ctx, keyPath).(type) {
+	case string:
+		return v, true
+	case float64:
+		// fmt.Sprint would use exponent notation for large ids.
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+// FileResolver resolves context values from records loaded from a local file.
+// If KeyPath is empty the whole file is returned as the resolved value.
+// Otherwise, the context value at KeyPath is used to pick a record.
+type FileResolver struct {
+	KeyPath []interface{}
+
+	records map[string]interface{}
+	data    interface{}
+}
+
+// NewFileResolver loads a resolver from a JSON or NDJSON file. Files ending
+// with .ndjson or .jsonl are read as NDJSON where every line is an object of
+// the form {"key": ..., "value": ...}. Any other file must contain a single
+// JSON document which, when keyPath is set, must be an object mapping record
+// keys to values.
+func NewFileResolver(path string, keyPath []interface{}) (*FileResolver, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	resolver := &FileResolver{
+		KeyPath: keyPath,
+		records: map[string]interface{}{},
+	}
+
+	if strings.HasSuffix(path, ".ndjson") || strings.HasSuffix(path, ".jsonl") {
+		if err := resolver.loadNDJSON(bytes.NewReader(data)); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err.Error())
+		}
+		return resolver, nil
+	}
+
+	if err := json.Unmarshal(data, &resolver.data); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+
+	if len(keyPath) > 0 {
+		records, ok := resolver.data.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: expected an object of records", path)
+		}
+		resolver.records = records
+	}
+
+	return resolver, nil
+}
+
+func (r *FileResolver) loadNDJSON(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		record := struct {
+			Key   interface{} `json:"key"`
+			Value interface{} `json:"value"`
+		}{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return fmt.Errorf("line %d: %s", line, err.Error())
+		}
+
+		key, ok := lookupKey(record.Key, nil)
+		if !ok {
+			return fmt.Errorf("line %d: record key must be a string, number or bool", line)
+		}
+		r.records[key] = record.Value
+	}
+
+	return scanner.Err()
+}
+
+func (r *FileResolver) Resolve(ctx interface{}, key string) (interface{}, error) {
+	if len(r.KeyPath) == 0 {
+		return r.data, nil
+	}
+
+	recordKey, ok := lookupKey(ctx, r.KeyPath)
+	if !ok {
+		return nil, nil
+	}
+
+	return r.records[recordKey], nil
+}
+
+// HTTPResolver resolves context values by issuing a GET request to URL. The
+// resolved key is passed in the "key" query parameter and, if KeyPath is set,
+// the context value at KeyPath is passed in the "id" query parameter. The
+// response body must contain a JSON value. 404 responses resolve to nil.
+type HTTPResolver struct {
+	URL     string
+	KeyPath []interface{}
+	Client  *http.Client
+}
+
+// NewHTTPResolver creates an HTTP resolver with a client that times out after
+// the given duration.
+func NewHTTPResolver(endpoint string, keyPath []interface{}, timeout time.Duration) *HTTPResolver {
+	return &HTTPResolver{
+		URL:     endpoint,
+		KeyPath: keyPath,
+		Client:  &http.Client{Timeout: timeout},
+	}
+}
+
+func (r *HTTPResolver) Resolve(ctx interface{}, key string) (interface{}, error) {
+	endpoint, err := url.Parse(r.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	query := endpoint.Query()
+	query.Set("key", key)
+	if len(r.KeyPath) > 0 {
+		id, ok := lookupKey(ctx, r.KeyPath)
+		if !ok {
+			return nil, nil
+		}
+		query.Set("id", id)
+	}
+	endpoint.RawQuery = query.Encode()
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Get(endpoint.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+
+	var val interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&val); err != nil {
+		return nil, err
+	}
+
+	return val, nil
+}
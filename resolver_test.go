@@ -0,0 +1,223 @@
+package condition
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestContextResolver(t *testing.T) {
+	calls := 0
+	evaluator := NewEvaluator()
+	evaluator.AddHandler("context", ContextExpressionHandler)
+	evaluator.AddHandler("and", AndExpressionHandler)
+	evaluator.AddResolver("account", ContextResolverFunc(func(ctx interface{}, key string) (interface{}, error) {
+		calls++
+		return map[string]interface{}{
+			"tier":    "gold",
+			"user_id": recursiveGet(ctx, []interface{}{"user_id"}),
+		}, nil
+	}))
+
+	testCases := []struct {
+		in    string
+		ctx   string
+		out   interface{}
+		calls int
+	}{
+		{
+			in:    `{"context": ["account", "tier"]}`,
+			ctx:   `{"user_id": 1}`,
+			out:   "gold",
+			calls: 1,
+		},
+		{
+			in:    `{"context": ["account", "user_id"]}`,
+			ctx:   `{"user_id": 1}`,
+			out:   float64(1),
+			calls: 1,
+		},
+		{
+			in:    `{"and": [{"context": ["account", "tier"]}, {"context": ["account", "user_id"]}]}`,
+			ctx:   `{"user_id": 1}`,
+			out:   true,
+			calls: 1,
+		},
+		{
+			in:    `{"context": ["account", "tier"]}`,
+			ctx:   `{"account": {"tier": "silver"}}`,
+			out:   "silver",
+			calls: 0,
+		},
+		{
+			in:    `{"context": ["user_id"]}`,
+			ctx:   `{"user_id": 1}`,
+			out:   float64(1),
+			calls: 0,
+		},
+	}
+
+	for _, test := range testCases {
+		calls = 0
+		root, err := Parse(test.in)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test.in, err.Error())
+		} else {
+			res, err := evaluator.Evaluate(test.ctx, root)
+			if err != nil {
+				t.Errorf("%q got an error: %s", test.in, err.Error())
+			} else {
+				if res != test.out {
+					t.Errorf("%q expected %v got %v", test.in, test.out, res)
+				}
+				if calls != test.calls {
+					t.Errorf("%q expected %d resolver calls got %d", test.in, test.calls, calls)
+				}
+			}
+		}
+	}
+}
+
+func TestFileResolver(t *testing.T) {
+	dir := t.TempDir()
+
+	jsonPath := filepath.Join(dir, "accounts.json")
+	if err := os.WriteFile(jsonPath, []byte(`{"1": {"tier": "gold"}, "2": {"tier": "silver"}, "1000000": {"tier": "platinum"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ndjsonPath := filepath.Join(dir, "accounts.ndjson")
+	if err := os.WriteFile(ndjsonPath, []byte("{\"key\": 1, \"value\": {\"tier\": \"bronze\"}}\n\n{\"key\": \"2\", \"value\": {\"tier\": \"iron\"}}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		path string
+		ctx  string
+		out  interface{}
+	}{
+		{
+			path: jsonPath,
+			ctx:  `{"user_id": 1}`,
+			out:  "gold",
+		},
+		{
+			path: jsonPath,
+			ctx:  `{"user_id": "2"}`,
+			out:  "silver",
+		},
+		{
+			path: jsonPath,
+			ctx:  `{"user_id": 3}`,
+			out:  nil,
+		},
+		{
+			path: jsonPath,
+			ctx:  `{"user_id": 1000000}`,
+			out:  "platinum",
+		},
+		{
+			path: ndjsonPath,
+			ctx:  `{"user_id": 1}`,
+			out:  "bronze",
+		},
+		{
+			path: ndjsonPath,
+			ctx:  `{"user_id": 2}`,
+			out:  "iron",
+		},
+	}
+
+	root, err := Parse(`{"context": ["account", "tier"]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range testCases {
+		resolver, err := NewFileResolver(test.path, []interface{}{"user_id"})
+		if err != nil {
+			t.Errorf("%s got an error: %s", test.path, err.Error())
+			continue
+		}
+
+		evaluator := NewEvaluator()
+		evaluator.AddHandler("context", ContextExpressionHandler)
+		evaluator.AddResolver("account", resolver)
+
+		res, err := evaluator.Evaluate(test.ctx, root)
+		if err != nil {
+			t.Errorf("%s %s got an error: %s", test.path, test.ctx, err.Error())
+		} else if res != test.out {
+			t.Errorf("%s %s expected %v got %v", test.path, test.ctx, test.out, res)
+		}
+	}
+}
+
+func TestHTTPResolver(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != "entitlements" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch r.URL.Query().Get("id") {
+		case "1":
+			w.Write([]byte(`["export", "sso"]`))
+		case "1000000":
+			w.Write([]byte(`["export", "audit"]`))
+		case "2":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	evaluator := NewEvaluator()
+	evaluator.AddHandler("context", ContextExpressionHandler)
+	evaluator.AddResolver("entitlements", NewHTTPResolver(server.URL, []interface{}{"user_id"}, time.Second))
+
+	testCases := []struct {
+		ctx string
+		out interface{}
+		err bool
+	}{
+		{
+			ctx: `{"user_id": 1}`,
+			out: "sso",
+		},
+		{
+			ctx: `{"user_id": 1000000}`,
+			out: "audit",
+		},
+		{
+			ctx: `{"user_id": 2}`,
+			err: true,
+		},
+		{
+			ctx: `{"user_id": 3}`,
+			out: nil,
+		},
+	}
+
+	root, err := Parse(`{"context": ["entitlements", 1]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range testCases {
+		res, err := evaluator.Evaluate(test.ctx, root)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s expected an error", test.ctx)
+			}
+		} else if err != nil {
+			t.Errorf("%s got an error: %s", test.ctx, err.Error())
+		} else if res != test.out {
+			t.Errorf("%s expected %v got %v", test.ctx, test.out, res)
+		}
+	}
+}
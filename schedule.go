@@ -0,0 +1,385 @@
+package condition
+
+import (
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxScheduleDuration limits how far back in_schedule looks for a matching
+// cron time.
+const maxScheduleDuration = 31 * 24 * time.Hour
+
+var cronMonthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var cronDayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// cronSchedule is a parsed five field cron expression. Every field is a bit
+// set of matching values.
+type cronSchedule struct {
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+
+	// domStar and dowStar are set if day of month or day of week fields
+	// start with a star. If neither does, a time matches when either of the
+	// fields matches, like in cron.
+	domStar bool
+	dowStar bool
+}
+
+// parseCron parses a standard five field cron expression: minute, hour, day of
+// month, month and day of week. Fields support *, lists, ranges, steps and
+// three letter month and day names.
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, newError(ErrorKindValue, "expected 5 fields in cron expression %q, got %d", expr, len(fields))
+	}
+
+	schedule := &cronSchedule{
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}
+
+	var err error
+	if schedule.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if schedule.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, err
+	}
+	if schedule.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, err
+	}
+	if schedule.month, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return nil, err
+	}
+	if schedule.dow, err = parseDays(fields[4]); err != nil {
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+// parseDays parses a day of week cron field. Both 0 and 7 mean Sunday.
+func parseDays(field string) (uint64, error) {
+	days, err := parseCronField(field, 0, 7, cronDayNames)
+	if err != nil {
+		return 0, err
+	}
+
+	if days&(1<<7) != 0 {
+		days |= 1
+	}
+
+	return days, nil
+}
+
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	var set uint64
+
+	for _, part := range strings.Split(field, ",") {
+		rangePart := part
+		step := 1
+		hasStep := false
+
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, newError(ErrorKindValue, "invalid step in cron field %q", field)
+			}
+			rangePart = part[:i]
+			hasStep = true
+		}
+
+		var lo, hi int
+		if rangePart == "*" {
+			lo, hi = min, max
+		} else {
+			bounds := strings.SplitN(rangePart, "-", 2)
+
+			var err error
+			if lo, err = parseCronValue(bounds[0], names); err != nil {
+				return 0, newError(ErrorKindValue, "invalid value in cron field %q", field)
+			}
+
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = parseCronValue(bounds[1], names); err != nil {
+					return 0, newError(ErrorKindValue, "invalid value in cron field %q", field)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, newError(ErrorKindValue, "value out of range in cron field %q", field)
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+
+	return set, nil
+}
+
+func parseCronValue(value string, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(value)]; ok {
+		return v, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// matches checks if t, in its own location, matches the schedule. Seconds are
+// ignored.
+func (c *cronSchedule) matches(t time.Time) bool {
+	return c.minute&(1<<uint(t.Minute())) != 0 &&
+		c.hour&(1<<uint(t.Hour())) != 0 &&
+		c.month&(1<<uint(t.Month())) != 0 &&
+		c.matchesDay(t)
+}
+
+// matchesDay checks if the day of t matches day of month and day of week
+// fields.
+func (c *cronSchedule) matchesDay(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return domMatch && dowMatch
+	}
+
+	return domMatch || dowMatch
+}
+
+// latest returns the latest time at or before t, truncated to a minute, that
+// matches the schedule in loc and is after limit. Rather than checking every
+// minute, it skips whole months, days and hours that don't match and jumps to
+// the previous matching minute within an hour.
+func (c *cronSchedule) latest(t, limit time.Time, loc *time.Location) (time.Time, bool) {
+	for t = t.Truncate(time.Minute).In(loc); t.After(limit); {
+		year, month, day := t.Date()
+		hour, minute := t.Hour(), t.Minute()
+
+		var next time.Time
+		switch {
+		case c.month&(1<<uint(month)) == 0:
+			next = time.Date(year, month, 1, 0, 0, 0, 0, loc).Add(-time.Minute)
+		case !c.matchesDay(t):
+			next = time.Date(year, month, day, 0, 0, 0, 0, loc).Add(-time.Minute)
+		case c.hour&(1<<uint(hour)) == 0:
+			next = time.Date(year, month, day, hour, 0, 0, 0, loc).Add(-time.Minute)
+		case c.minute&(1<<uint(minute)) == 0:
+			// Without an earlier matching minute this is the last minute of
+			// the previous hour.
+			previous := bits.Len64(c.minute&(1<<uint(minute)-1)) - 1
+			next = t.Add(-time.Duration(minute-previous) * time.Minute)
+		default:
+			return t, true
+		}
+
+		// Around time zone transitions a skipped period may not start
+		// before t, fall back to the previous minute then.
+		if !next.Before(t) {
+			next = t.Add(-time.Minute)
+		}
+		t = next
+	}
+
+	return time.Time{}, false
+}
+
+// evaluateCron evaluates and parses the cron expression argument at index i.
+// Literal expressions are parsed once and cached on the argument node.
+func evaluateCron(args *Args, i int) (*cronSchedule, error) {
+	n, err := args.node(i)
+	if err != nil {
+		return nil, err
+	}
+
+	if schedule, ok := n.compiled.Load().(*cronSchedule); ok {
+		return schedule, nil
+	}
+
+	expr, err := evaluateString(args, i)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule, err := parseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.Type == NodeTypeLiteral {
+		n.compiled.Store(schedule)
+	}
+
+	return schedule, nil
+}
+
+// evaluateLocation evaluates an optional time zone argument at index i. A
+// missing or null time zone means UTC.
+func evaluateLocation(args *Args, i int) (*time.Location, error) {
+	if !args.Has(i) {
+		return time.UTC, nil
+	}
+
+	res, err := args.Value(i)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := res.(type) {
+	case nil:
+		return time.UTC, nil
+	case string:
+		loc, err := time.LoadLocation(v)
+		if err != nil {
+			return nil, newError(ErrorKindValue, "unknown time zone %q", v)
+		}
+		return loc, nil
+	}
+
+	return nil, newError(ErrorKindType, "expected time zone name as a string, got %s", typeOf(res))
+}
+
+func evaluateString(args *Args, i int) (string, error) {
+	res, err := args.Value(i)
+	if err != nil {
+		return "", err
+	}
+
+	asString, ok := res.(string)
+	if !ok {
+		return "", newError(ErrorKindType, "expected string, got %s", typeOf(res))
+	}
+
+	return asString, nil
+}
+
+// InScheduleExpressionHandler returns true if current time is within a
+// duration after a time matching a cron expression. It takes a cron
+// expression, a duration, e.g. "8h30m", and an optional time zone name the
+// cron expression is evaluated in, which defaults to UTC.
+func InScheduleExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	args := NewArgs(e, n)
+	schedule, err := evaluateCron(args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	durationString, err := evaluateString(args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	duration, err := time.ParseDuration(durationString)
+	if err != nil || duration <= 0 || duration > maxScheduleDuration {
+		return nil, newError(ErrorKindValue, "duration must be positive and at most %s, got %q", maxScheduleDuration, durationString)
+	}
+
+	loc, err := evaluateLocation(args, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	now := e.currentTime()
+	_, ok := schedule.latest(now, now.Add(-duration), loc)
+
+	return ok, nil
+}
+
+// parseClock parses a time of day in HH:MM format and returns minutes since
+// midnight. 24:00 is accepted as the end of a day.
+func parseClock(value string) (int, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) == 2 {
+		hours, hoursErr := strconv.Atoi(parts[0])
+		minutes, minutesErr := strconv.Atoi(parts[1])
+		if hoursErr == nil && minutesErr == nil && hours >= 0 && minutes >= 0 && minutes < 60 &&
+			(hours < 24 || (hours == 24 && minutes == 0)) {
+			return hours*60 + minutes, nil
+		}
+	}
+
+	return 0, newError(ErrorKindValue, "expected time of day in HH:MM format, got %q", value)
+}
+
+// InWindowExpressionHandler returns true if current time is within a weekly
+// recurring window. It takes days of the week, window start and end times in
+// HH:MM format and an optional time zone name, which defaults to UTC. Days are
+// a cron style day of week field, e.g. "mon-fri" or "sat,sun", or a list of
+// such fields. If the end time is not after the start time, the window ends on
+// the following day.
+func InWindowExpressionHandler(e *Evaluator, n *Node) (interface{}, error) {
+	args := NewArgs(e, n)
+	daysValue, err := args.Value(0)
+	if err != nil {
+		return nil, err
+	}
+
+	var dayFields []interface{}
+	switch v := daysValue.(type) {
+	case string:
+		dayFields = []interface{}{v}
+	case []interface{}:
+		dayFields = v
+	default:
+		return nil, newError(ErrorKindType, "expected days as a string or a list of strings, got %s", typeOf(daysValue))
+	}
+
+	var days uint64
+	for _, field := range dayFields {
+		fieldString, ok := field.(string)
+		if !ok {
+			return nil, newError(ErrorKindType, "expected days as a string or a list of strings, got %s", typeOf(field))
+		}
+
+		set, err := parseDays(fieldString)
+		if err != nil {
+			return nil, err
+		}
+		days |= set
+	}
+
+	bounds := [2]int{}
+	for i := range bounds {
+		value, err := evaluateString(args, i+1)
+		if err != nil {
+			return nil, err
+		}
+
+		if bounds[i], err = parseClock(value); err != nil {
+			return nil, err
+		}
+	}
+	start, end := bounds[0], bounds[1]
+
+	loc, err := evaluateLocation(args, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	now := e.currentTime().In(loc)
+	minutes := now.Hour()*60 + now.Minute()
+	today := days&(1<<uint(now.Weekday())) != 0
+	yesterday := days&(1<<uint((now.Weekday()+6)%7)) != 0
+
+	if start < end {
+		return today && minutes >= start && minutes < end, nil
+	}
+
+	return (today && minutes >= start) || (yesterday && minutes < end), nil
+}
@@ -0,0 +1,215 @@
+package condition
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	evaluator := NewDefaultEvaluator()
+
+	testCases := []struct {
+		in  string
+		now string
+		out bool
+	}{
+		// 2026-10-19 is a Monday, Europe/Vilnius is UTC+3 until 2026-10-25.
+		{in: `{"in_schedule": ["0 9 * * 1-5", "8h", "Europe/Vilnius"]}`, now: "2026-10-19T06:30:00Z", out: true},
+		{in: `{"in_schedule": ["0 9 * * 1-5", "8h", "Europe/Vilnius"]}`, now: "2026-10-19T05:59:59Z", out: false},
+		{in: `{"in_schedule": ["0 9 * * 1-5", "8h", "Europe/Vilnius"]}`, now: "2026-10-19T13:59:59Z", out: true},
+		{in: `{"in_schedule": ["0 9 * * 1-5", "8h", "Europe/Vilnius"]}`, now: "2026-10-19T14:00:00Z", out: false},
+		{in: `{"in_schedule": ["0 9 * * 1-5", "8h", "Europe/Vilnius"]}`, now: "2026-10-24T07:00:00Z", out: false},
+		{in: `{"in_schedule": ["0 9 * * mon-fri", "8h", "Europe/Vilnius"]}`, now: "2026-10-26T07:30:00Z", out: true},
+		{in: `{"in_schedule": ["0 9 * * mon-fri", "8h", "Europe/Vilnius"]}`, now: "2026-10-26T06:30:00Z", out: false},
+		{in: `{"in_schedule": ["0 9 * * 1-5", "8h"]}`, now: "2026-10-19T09:00:00Z", out: true},
+		{in: `{"in_schedule": ["*/15 * * * *", "5m"]}`, now: "2026-10-19T10:04:59Z", out: true},
+		{in: `{"in_schedule": ["*/15 * * * *", "5m"]}`, now: "2026-10-19T10:05:00Z", out: false},
+		{in: `{"in_schedule": ["0 0 1 * mon", "1h"]}`, now: "2026-10-19T00:30:00Z", out: true},
+		{in: `{"in_schedule": ["0 0 1 * mon", "1h"]}`, now: "2026-10-01T00:30:00Z", out: true},
+		{in: `{"in_schedule": ["0 0 1 * mon", "1h"]}`, now: "2026-10-20T00:30:00Z", out: false},
+		{in: `{"in_schedule": ["0 0 * * 7", "1h"]}`, now: "2026-10-18T00:30:00Z", out: true},
+		{in: `{"in_schedule": ["0 22 * * fri", "4h"]}`, now: "2026-10-24T01:00:00Z", out: true},
+		{in: `{"in_schedule": ["0 22 * * fri", "4h"]}`, now: "2026-10-24T02:00:00Z", out: false},
+		{in: `{"in_schedule": ["0 0 * dec *", "24h"]}`, now: "2026-12-05T10:00:00Z", out: true},
+		{in: `{"in_schedule": ["0 0 * dec *", "24h"]}`, now: "2026-11-05T10:00:00Z", out: false},
+		{in: `{"in_schedule": ["30 1-3/2 * * *", "1m"]}`, now: "2026-11-05T03:30:30Z", out: true},
+		{in: `{"in_schedule": ["30 1-3/2 * * *", "1m"]}`, now: "2026-11-05T02:30:30Z", out: false},
+		{in: `{"in_window": ["mon-fri", "09:00", "17:00", "Europe/Vilnius"]}`, now: "2026-10-19T06:30:00Z", out: true},
+		{in: `{"in_window": ["mon-fri", "09:00", "17:00", "Europe/Vilnius"]}`, now: "2026-10-19T14:00:00Z", out: false},
+		{in: `{"in_window": ["mon-fri", "09:00", "17:00", "Europe/Vilnius"]}`, now: "2026-10-24T08:00:00Z", out: false},
+		{in: `{"in_window": ["mon-fri", "09:00", "17:00", "Europe/Vilnius"]}`, now: "2026-10-26T07:00:00Z", out: true},
+		{in: `{"in_window": ["fri", "22:00", "06:00"]}`, now: "2026-10-23T23:00:00Z", out: true},
+		{in: `{"in_window": ["fri", "22:00", "06:00"]}`, now: "2026-10-24T05:59:00Z", out: true},
+		{in: `{"in_window": ["fri", "22:00", "06:00"]}`, now: "2026-10-24T06:00:00Z", out: false},
+		{in: `{"in_window": ["fri", "22:00", "06:00"]}`, now: "2026-10-22T23:00:00Z", out: false},
+		{in: `{"in_window": [["sat", "sun"], "00:00", "24:00"]}`, now: "2026-10-25T23:59:00Z", out: true},
+		{in: `{"in_window": ["sat,sun", "00:00", "24:00"]}`, now: "2026-10-26T00:00:00Z", out: false},
+		{in: `{"in_window": ["*", "12:00", "12:00"]}`, now: "2026-10-26T11:00:00Z", out: true},
+	}
+
+	for _, test := range testCases {
+		now, err := time.Parse(time.RFC3339, test.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		evaluator.SetClock(func() time.Time { return now })
+
+		root, err := Parse(test.in)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test.in, err.Error())
+		} else {
+			res, err := evaluator.Evaluate(nil, root)
+			if err != nil {
+				t.Errorf("%q at %s got an error: %s", test.in, test.now, err.Error())
+			} else if res != test.out {
+				t.Errorf("%q at %s expected %v got %v", test.in, test.now, test.out, res)
+			}
+		}
+	}
+
+	errorCases := []string{
+		`{"in_schedule": ["0 9 * *", "8h"]}`,
+		`{"in_schedule": ["0 24 * * *", "8h"]}`,
+		`{"in_schedule": ["0 9 * * xyz", "8h"]}`,
+		`{"in_schedule": ["0 9-8 * * *", "8h"]}`,
+		`{"in_schedule": ["*/0 9 * * *", "8h"]}`,
+		`{"in_schedule": ["0 9 * * *", "forever"]}`,
+		`{"in_schedule": ["0 9 * * *", "-1h"]}`,
+		`{"in_schedule": ["0 9 * * *", "1000h"]}`,
+		`{"in_schedule": ["0 9 * * *", "8h", "Mars/Olympus"]}`,
+		`{"in_window": ["mon", "9:00"]}`,
+		`{"in_window": ["mon", "9", "10:00"]}`,
+		`{"in_window": ["mon", "09:00", "24:01"]}`,
+		`{"in_window": [1, "09:00", "10:00"]}`,
+		`{"in_window": ["someday", "09:00", "10:00"]}`,
+	}
+
+	for _, test := range errorCases {
+		root, err := Parse(test)
+		if err != nil {
+			t.Errorf("%q got an error: %s", test, err.Error())
+		} else if _, err := evaluator.Evaluate(nil, root); err == nil {
+			t.Errorf("%q expected an error", test)
+		}
+	}
+}
+
+func TestClockReadOncePerEvaluation(t *testing.T) {
+	calls := 0
+	evaluator := NewDefaultEvaluator()
+	evaluator.SetClock(func() time.Time {
+		calls++
+		return time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	})
+
+	root, err := Parse(`{"and": [{"in_window": ["mon", "09:00", "17:00"]}, {"in_schedule": ["0 9 * * *", "8h"]}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		res, err := evaluator.Evaluate(nil, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != true {
+			t.Errorf("expected true got %v", res)
+		}
+		if calls != i {
+			t.Errorf("expected %d clock reads got %d", i, calls)
+		}
+	}
+}
+
+func TestCronLatest(t *testing.T) {
+	expressions := []string{
+		"* * * * *",
+		"0 9 * * 1-5",
+		"*/7 */5 * * *",
+		"30 2 * * *",
+		"59 23 31 * *",
+		"0 0 29 feb *",
+		"15 1 1 * mon",
+		"0,45 3-4 * mar,oct,nov sun",
+		"0 12 13 * fri",
+	}
+	locations := []string{"UTC", "Europe/Vilnius", "America/New_York", "Asia/Kolkata", "Australia/Lord_Howe"}
+	times := []string{
+		"2026-03-29T00:59:30Z", // DST starts in Europe
+		"2026-10-25T01:30:00Z", // DST ends in Europe
+		"2026-03-08T07:10:00Z", // DST starts in America/New_York
+		"2026-11-01T06:20:00Z", // DST ends in America/New_York
+		"2026-04-05T15:05:00Z", // DST ends in Australia/Lord_Howe
+		"2028-03-01T00:00:00Z",
+		"2026-12-31T23:59:59Z",
+	}
+	durations := []time.Duration{time.Minute, 90 * time.Minute, 25 * time.Hour, maxScheduleDuration}
+
+	for _, expr := range expressions {
+		schedule, err := parseCron(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range locations {
+			loc, err := time.LoadLocation(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, value := range times {
+				now, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for _, duration := range durations {
+					// Every minute is checked to find the expected time.
+					var expected time.Time
+					for start := now.Truncate(time.Minute); now.Sub(start) < duration; start = start.Add(-time.Minute) {
+						if schedule.matches(start.In(loc)) {
+							expected = start
+							break
+						}
+					}
+
+					got, ok := schedule.latest(now, now.Add(-duration), loc)
+					if ok != !expected.IsZero() || !got.Equal(expected) {
+						t.Errorf("%q in %s at %s within %s: expected %s got %s, %v", expr, name, value, duration, expected, got, ok)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestCronParsedOnce(t *testing.T) {
+	evaluator := NewDefaultEvaluator()
+	evaluator.SetClock(func() time.Time { return time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC) })
+
+	root, err := Parse(`{"and": [{"in_schedule": ["0 9 * * *", "8h"]}, {"in_schedule": [{"context": "cron"}, "8h"]}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := map[string]interface{}{"cron": "0 10 * * *"}
+	if res, err := evaluator.Evaluate(ctx, root); err != nil || res != true {
+		t.Fatalf("expected true got %v, %v", res, err)
+	}
+
+	literal := root.Children[0].Children[0].Children[0].Children[0]
+	if _, ok := literal.compiled.Load().(*cronSchedule); !ok {
+		t.Errorf("expected the literal cron expression to be cached")
+	}
+
+	// Expressions from the context may change between evaluations.
+	fromContext := root.Children[0].Children[1].Children[0].Children[0]
+	if fromContext.compiled.Load() != nil {
+		t.Errorf("expected the cron expression from the context not to be cached")
+	}
+
+	ctx["cron"] = "0 13 * * *"
+	if res, err := evaluator.Evaluate(ctx, root); err != nil || res != false {
+		t.Errorf("expected false got %v, %v", res, err)
+	}
+}
@@ -0,0 +1,104 @@
+package condition
+
+// scope holds a single variable binding created by the let expression. Scopes
+// are chained through parent so that inner bindings shadow outer ones.
+type scope struct {
+	parent  *scope
+	name    string
+	binding *binding
+}
+
+// binding is a lazily evaluated variable value. The bound expression is
+// evaluated at most once, in the scope where it was defined.
+type binding struct {
+	node  *Node
+	scope *scope
+
+	evaluated bool
+	value     interface{}
+	err       error
+}
+
+func (s *scope) lookup(name string) (*binding, bool) {
+	for current := s; current != nil; current = current.parent {
+		if current.name == name {
+			return current.binding, true
+		}
+	}
+	return nil, false
+}
+
+// evaluateBinding returns the value of b, evaluating it in its defining scope
+// on first use.
+func (e *Evaluator) evaluateBinding(b *binding) (interface{}, error) {
+	if b.evaluated {
+		return b.value, b.err
+	}
+
+	saved := e.scope
+	e.scope = b.scope
+	b.value, b.err = e.evaluateNode(b.node)
+	e.scope = saved
+	b.evaluated = true
+
+	return b.value, b.err
+}
+
+// CheckVariables statically checks that var expressions in the tree rooted at
+// n reference variables bound by an enclosing let expression or one of names,
+// e.g. macro parameters. Unlike evaluation, it also checks branches that
+// would not be evaluated. Variable names that are not string literals and
+// malformed bindings are left to evaluation.
+func CheckVariables(n *Node, names ...string) error {
+	var s *scope
+	for _, name := range names {
+		s = &scope{parent: s, name: name}
+	}
+
+	return checkVariables(n, s)
+}
+
+func checkVariables(n *Node, s *scope) error {
+	if n.Type == NodeTypeFunction {
+		params := functionArgs(n)
+		switch FunctionName(n) {
+		case "var":
+			if len(params) == 1 && params[0].Type == NodeTypeLiteral {
+				if name, ok := params[0].Token.Value.(string); ok {
+					if _, ok := s.lookup(name); !ok {
+						return newError(ErrorKindUndefined, "undefined variable %q", name)
+					}
+				}
+			}
+		case "let":
+			if len(params) < 2 {
+				break
+			}
+
+			// Bindings see the bindings before them, the body sees all.
+			for _, param := range params[:len(params)-1] {
+				if param.Type != NodeTypeFunction || len(param.Children) != 1 {
+					if err := checkVariables(param, s); err != nil {
+						return err
+					}
+					continue
+				}
+
+				if err := checkVariables(param.Children[0], s); err != nil {
+					return err
+				}
+				s = &scope{parent: s, name: FunctionName(param)}
+			}
+
+			return checkVariables(params[len(params)-1], s)
+		}
+	}
+
+	for _, child := range n.Children {
+		if err := checkVariables(child, s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,23 @@
+package condition
+
+// TraceEntry records a notable event that happened during evaluation, such as
+// an error swallowed by the try expression.
+type TraceEntry struct {
+	// Expression is the name of the expression that recorded the entry.
+	Expression string `json:"expression"`
+
+	// Kind is the kind of the recorded error.
+	Kind ErrorKind `json:"kind,omitempty"`
+
+	// Message describes the event.
+	Message string `json:"message"`
+}
+
+// Trace returns entries recorded during the last evaluation.
+func (e *Evaluator) Trace() []TraceEntry {
+	return e.trace
+}
+
+func (e *Evaluator) addTrace(entry TraceEntry) {
+	e.trace = append(e.trace, entry)
+}
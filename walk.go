@@ -0,0 +1,184 @@
+package condition
+
+import (
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+	"math"
+	"sync/atomic"
+)
+
+// Visitor is called by Walk for every node. Returning false skips the
+// children of n.
+type Visitor func(n *Node) bool
+
+// Walk visits n and its descendants in depth-first order, parents before
+// their children.
+func Walk(n *Node, visit Visitor) {
+	if n == nil || !visit(n) {
+		return
+	}
+
+	for _, child := range n.Children {
+		Walk(child, visit)
+	}
+}
+
+// Rewrite replaces nodes in the tree rooted at n with the results of f and
+// returns the new root. Children are rewritten before their parents, so f
+// sees the rewritten children of a node. f returns n or nil to keep a node.
+// The tree is modified in place, use Clone to keep the original. Parent
+// pointers of replacements and their descendants are updated, and if n has a
+// parent, n is replaced among its children.
+func Rewrite(n *Node, f func(*Node) *Node) *Node {
+	if n == nil {
+		return nil
+	}
+
+	parent := n.Parent
+	root := rewrite(n, f)
+	root.Parent = parent
+
+	if parent == nil {
+		return root
+	}
+
+	for i, child := range parent.Children {
+		if child == n {
+			parent.Children[i] = root
+		}
+	}
+
+	return root
+}
+
+func rewrite(n *Node, f func(*Node) *Node) *Node {
+	if n == nil {
+		return nil
+	}
+
+	for i, child := range n.Children {
+		replacement := rewrite(child, f)
+		replacement.Parent = n
+		n.Children[i] = replacement
+	}
+
+	// Pre-processed values of rewritten nodes may be stale.
+	n.compiled = atomic.Value{}
+
+	replacement := f(n)
+	if replacement == nil {
+		return n
+	}
+
+	// Replacements may reuse nodes of the original tree at any depth.
+	setParents(replacement)
+
+	return replacement
+}
+
+// setParents points the children of n and of its descendants to their
+// parents.
+func setParents(n *Node) {
+	for _, child := range n.Children {
+		child.Parent = n
+		setParents(child)
+	}
+}
+
+// Clone returns a deep copy of n. The copy has no parent. Pre-processed
+// values are shared, they are not modified after they are created.
+func (n *Node) Clone() *Node {
+	if n == nil {
+		return nil
+	}
+
+	c := &Node{
+		Type:  n.Type,
+		Token: n.Token,
+	}
+	if compiled := n.compiled.Load(); compiled != nil {
+		c.compiled.Store(compiled)
+	}
+
+	for _, child := range n.Children {
+		cloned := child.Clone()
+		cloned.Parent = c
+		c.appendChild(cloned)
+	}
+
+	return c
+}
+
+// Equal returns true if n and other are the same expression. Parents are not
+// compared.
+func (n *Node) Equal(other *Node) bool {
+	if n == nil || other == nil {
+		return n == other
+	}
+
+	if n.Type != other.Type || n.Token.Value != other.Token.Value || len(n.Children) != len(other.Children) {
+		return false
+	}
+
+	for i := range n.Children {
+		if !n.Children[i].Equal(other.Children[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Hash returns a structural hash of n. Equal nodes have equal hashes. The
+// hash doesn't depend on the process, so it can be stored, e.g. to cache
+// results or detect changed conditions.
+func (n *Node) Hash() uint64 {
+	h := fnv.New64a()
+	writeHash(h, n)
+	return h.Sum64()
+}
+
+func writeHash(h hash.Hash, n *Node) {
+	buf := make([]byte, 9)
+	if n == nil {
+		h.Write(buf[:1])
+		return
+	}
+
+	buf[0] = byte(n.Type) + 1
+	h.Write(buf[:1])
+
+	switch v := n.Token.Value.(type) {
+	case nil:
+		buf[0] = 'n'
+		h.Write(buf[:1])
+	case bool:
+		buf[0], buf[1] = 'b', 0
+		if v {
+			buf[1] = 1
+		}
+		h.Write(buf[:2])
+	case float64:
+		// Equal treats 0 and -0 as the same number.
+		if v == 0 {
+			v = 0
+		}
+		buf[0] = 'f'
+		binary.BigEndian.PutUint64(buf[1:], math.Float64bits(v))
+		h.Write(buf)
+	case string:
+		buf[0] = 's'
+		binary.BigEndian.PutUint64(buf[1:], uint64(len(v)))
+		h.Write(buf)
+		h.Write([]byte(v))
+	}
+
+	buf[0] = 'c'
+	binary.BigEndian.PutUint64(buf[1:], uint64(len(n.Children)))
+	h.Write(buf)
+
+	for _, child := range n.Children {
+		writeHash(h, child)
+	}
+}
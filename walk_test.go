@@ -0,0 +1,241 @@
+package condition
+
+import (
+	"math"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	root := mustParse(t, `{"and": [{"eq": [{"context": "a"}, 1]}, {"not": {"context": "b"}}]}`)
+
+	names := []string{}
+	Walk(root, func(n *Node) bool {
+		names = append(names, getNodeName(n))
+		return FunctionName(n) != "not"
+	})
+
+	args := root.Children[0]
+	eq := args.Children[0]
+	expected := []string{
+		getNodeName(root),
+		getNodeName(args),
+		getNodeName(eq),
+		getNodeName(eq.Children[0]),
+		getNodeName(eq.Children[0].Children[0]),
+		getNodeName(eq.Children[0].Children[0].Children[0]),
+		getNodeName(eq.Children[0].Children[1]),
+		getNodeName(args.Children[1]),
+	}
+
+	if len(names) != len(expected) {
+		t.Fatalf("expected %v got %v", expected, names)
+	}
+	for i := range names {
+		if names[i] != expected[i] {
+			t.Errorf("expected %v got %v", expected, names)
+			break
+		}
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	// Rename a function and inline a context path.
+	root := mustParse(t, `{"and": [{"equals": [{"context": "tier"}, "gold"]}, {"context": "active"}]}`)
+	rewritten := Rewrite(root, func(n *Node) *Node {
+		if FunctionName(n) == "equals" {
+			n.Token.Value = "eq"
+		}
+		if FunctionName(n) == "context" {
+			if v, ok := literalValue(n.Children[0]); ok && v == "active" {
+				return newLiteralNode(nil, Token{Value: true})
+			}
+		}
+		return nil
+	})
+
+	checkParents(t, rewritten)
+	if rewritten.Parent != nil {
+		t.Errorf("expected root without parent")
+	}
+
+	expected := mustParse(t, `{"and": [{"eq": [{"context": "tier"}, "gold"]}, true]}`)
+	if !rewritten.Equal(expected) {
+		t.Errorf("expected\n%s\ngot\n%s", Stringify(expected), Stringify(rewritten))
+	}
+
+	res, err := NewDefaultEvaluator().Evaluate(map[string]interface{}{"tier": "gold"}, rewritten)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != true {
+		t.Errorf("expected true got %v", res)
+	}
+}
+
+func TestRewriteSubtree(t *testing.T) {
+	root := mustParse(t, `{"or": [{"context": "a"}, {"not": {"context": "b"}}]}`)
+	not := root.Children[0].Children[1]
+
+	replaced := Rewrite(not, func(n *Node) *Node {
+		if FunctionName(n) == "not" {
+			return mustParse(t, `false`)
+		}
+		return nil
+	})
+
+	if replaced.Parent != not.Parent {
+		t.Errorf("expected replacement to keep the parent")
+	}
+	checkParents(t, root)
+
+	expected := mustParse(t, `{"or": [{"context": "a"}, false]}`)
+	if !root.Equal(expected) {
+		t.Errorf("expected\n%s\ngot\n%s", Stringify(expected), Stringify(root))
+	}
+}
+
+func TestRewriteReusedChildren(t *testing.T) {
+	// Replace not with eq, reusing the children of not, and wrap context
+	// arguments in a new array.
+	root := mustParse(t, `{"and": [{"not": [{"context": "a"}, false]}, {"context": "b"}]}`)
+	rewritten := Rewrite(root, func(n *Node) *Node {
+		switch FunctionName(n) {
+		case "not":
+			return &Node{Type: NodeTypeFunction, Token: Token{Value: "eq"}, Children: n.Children}
+		case "context":
+			args := newArrayNode(nil)
+			args.Children = n.Children
+			return &Node{Type: NodeTypeFunction, Token: n.Token, Children: []*Node{args}}
+		}
+		return nil
+	})
+
+	checkParents(t, rewritten)
+
+	expected := mustParse(t, `{"and": [{"eq": [{"context": ["a"]}, false]}, {"context": ["b"]}]}`)
+	if !rewritten.Equal(expected) {
+		t.Errorf("expected\n%s\ngot\n%s", Stringify(expected), Stringify(rewritten))
+	}
+}
+
+func TestRewriteResetsCompiled(t *testing.T) {
+	root := mustParse(t, `{"geo_in_polygon": [{"context": "point"}, [[[0, 0], [10, 0], [10, 10], [0, 10], [0, 0]]]]}`)
+	ctx := map[string]interface{}{"point": []interface{}{15.0, 15.0}}
+
+	evaluator := NewDefaultEvaluator()
+	if res, err := evaluator.Evaluate(ctx, root); err != nil || res != false {
+		t.Fatalf("expected false got %v, %v", res, err)
+	}
+
+	// Scale the polygon, so that it contains the point.
+	root = Rewrite(root, func(n *Node) *Node {
+		if v, ok := literalValue(n); ok && v == 10.0 {
+			return newLiteralNode(nil, Token{Value: 20.0})
+		}
+		return nil
+	})
+
+	polygon := root.Children[0].Children[1]
+	if polygon.compiled.Load() != nil {
+		t.Fatalf("expected the stale polygon to be dropped")
+	}
+
+	res, err := evaluator.Evaluate(ctx, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != true {
+		t.Errorf("expected true got %v", res)
+	}
+}
+
+func TestClone(t *testing.T) {
+	root := mustParse(t, `{"and": [{"geo_in_polygon": [[5, 5], [[[0, 0], [10, 0], [10, 10], [0, 10], [0, 0]]]]}, {"context": "a"}]}`)
+	if _, err := NewDefaultEvaluator().Evaluate(map[string]interface{}{"a": true}, root); err != nil {
+		t.Fatal(err)
+	}
+	root.Parent = &Node{Type: NodeTypeArray}
+
+	c := root.Clone()
+	if c.Parent != nil {
+		t.Errorf("expected clone without parent")
+	}
+	checkParents(t, c)
+
+	if !c.Equal(root) {
+		t.Errorf("expected\n%s\ngot\n%s", Stringify(root), Stringify(c))
+	}
+
+	// Compiled values are kept.
+	polygon := c.Children[0].Children[0].Children[0].Children[1]
+	if _, ok := polygon.compiled.Load().(geoShape); !ok {
+		t.Errorf("expected polygon to be compiled, got %#v", polygon.compiled.Load())
+	}
+
+	// Changing the clone doesn't change the original.
+	c.Children[0].Children[1].Children[0].Token.Value = "b"
+	c.Children[0].Children = c.Children[0].Children[:1]
+	if got := root.Children[0].Children[1].Children[0].Token.Value; got != "a" {
+		t.Errorf("original was modified: %v", got)
+	}
+	if c.Equal(root) {
+		t.Errorf("expected clone to differ")
+	}
+
+	if (*Node)(nil).Clone() != nil {
+		t.Errorf("expected nil clone of nil")
+	}
+}
+
+func TestEqualAndHash(t *testing.T) {
+	equal := [][2]string{
+		{`true`, `true`},
+		{`{"and": [{"context": "a"}, 1]}`, `{ "and" : [ {"context": "a"}, 1.0 ] }`},
+		{`0`, `-0`},
+		{`[]`, `[]`},
+	}
+
+	for _, test := range equal {
+		a, b := mustParse(t, test[0]), mustParse(t, test[1])
+		if !a.Equal(b) {
+			t.Errorf("%s and %s: expected equal", test[0], test[1])
+		}
+		if a.Hash() != b.Hash() {
+			t.Errorf("%s and %s: expected equal hashes", test[0], test[1])
+		}
+	}
+
+	different := []string{
+		`true`, `false`, `null`, `0`, `1`, `"1"`, `""`, `[]`, `[[]]`, `[null]`,
+		`["a", "b"]`, `["ab"]`, `[["a"], "b"]`, `["a", ["b"]]`,
+		`{"context": "a"}`, `{"context": ["a"]}`, `{"exists": "a"}`,
+		`{"and": [{"context": "a"}, {"context": "b"}]}`,
+		`{"and": [{"context": "b"}, {"context": "a"}]}`,
+	}
+
+	hashes := map[uint64]string{}
+	for i, a := range different {
+		root := mustParse(t, a)
+		if prev, ok := hashes[root.Hash()]; ok {
+			t.Errorf("%s and %s have the same hash", prev, a)
+		}
+		hashes[root.Hash()] = a
+
+		for j, b := range different {
+			if root.Equal(mustParse(t, b)) != (i == j) {
+				t.Errorf("%s and %s: expected Equal to be %v", a, b, i == j)
+			}
+		}
+	}
+
+	var n *Node
+	if !n.Equal(nil) || n.Equal(mustParse(t, `null`)) || mustParse(t, `null`).Equal(nil) {
+		t.Errorf("unexpected Equal result for nil nodes")
+	}
+
+	// NaN can't be parsed, but can be created by a rewrite.
+	nan := &Node{Type: NodeTypeLiteral, Token: Token{Value: math.NaN()}}
+	if nan.Hash() != nan.Clone().Hash() {
+		t.Errorf("expected equal hashes for NaN")
+	}
+}